@@ -5,10 +5,10 @@ go 1.22.1
 require (
 	github.com/sashabaranov/go-openai v1.26.2
 	golang.org/x/exp v0.0.0-20240719175910-8a7402abbf56
+	golang.org/x/mod v0.19.0
 	golang.org/x/tools v0.23.0
 )
 
 require (
-	golang.org/x/mod v0.19.0 // indirect
 	golang.org/x/sync v0.7.0 // indirect
 )
@@ -3,15 +3,38 @@ package chattest
 import (
 	"flag"
 	"fmt"
+	"time"
 )
 
 type Config struct {
 	RepoPath        string
 	FuncPath        string
 	FuncName        string
+	TypeName        string
+	TestsPerFunc    int
 	RepairRounds    int
 	RandomTestCount int
 	UseFuncTestFile bool
+	CassettePath    string
+	CassetteMode    string
+	Model           string
+	NoCache         bool
+	CacheDir        string
+	CacheTTL        time.Duration
+	CacheMaxBytes   int64
+	MaxRetries      int
+	RequestsPerMin  int
+	TokensPerMin    int
+	Quiet           bool
+	History         string
+	HistoryRounds   int
+	PromptDir       string
+	DryRun          bool
+	DryRunJSON      bool
+	Strategy        string
+	Kind            string
+	FuzzTime        time.Duration
+	BenchTime       string
 }
 
 func NewConfig() (*Config, error) {
@@ -28,9 +51,31 @@ func (c *Config) flags() error {
 	flag.StringVar(&c.RepoPath, "repo", "", "path to the repository")
 	flag.StringVar(&c.FuncPath, "func-path", "", "file path to the function under test")
 	flag.StringVar(&c.FuncName, "func", "", "name of the function under test")
+	flag.StringVar(&c.TypeName, "type", "", "name of a type declared in -func-path, to generate a suite for its constructors and methods instead of -func")
 	flag.IntVar(&c.RepairRounds, "rounds", 0, "number of repair rounds")
+	flag.IntVar(&c.TestsPerFunc, "tests-per-func", 1, "number of tests asked for, each covering a distinct scenario such as the happy path, error paths and edge cases")
 	flag.IntVar(&c.RandomTestCount, "test-count", 0, "number of random tests to pick for prompt augmentation")
 	flag.BoolVar(&c.UseFuncTestFile, "use-func-test-file", false, "if it exists, use the test file of the function under test for prompt augmentation")
+	flag.StringVar(&c.CassettePath, "cassette", "", "path to a cassette file to record LLM interactions to, or replay them from")
+	flag.StringVar(&c.CassetteMode, "cassette-mode", "replay", "cassette mode: record or replay")
+	flag.StringVar(&c.Model, "model", "gpt-4o-mini", "name of the LLM model")
+	flag.BoolVar(&c.NoCache, "no-cache", false, "bypass the on-disk LLM response cache")
+	flag.StringVar(&c.CacheDir, "cache-dir", "", "directory of the LLM response cache, defaults to the user cache directory")
+	flag.DurationVar(&c.CacheTTL, "cache-ttl", 7*24*time.Hour, "how long cached LLM responses are reused, 0 for no expiry")
+	flag.Int64Var(&c.CacheMaxBytes, "cache-max-bytes", 100<<20, "maximum size of the LLM response cache in bytes, 0 for no limit")
+	flag.IntVar(&c.MaxRetries, "max-retries", 5, "number of retries of a failed LLM request")
+	flag.IntVar(&c.RequestsPerMin, "rpm", 0, "maximum LLM requests per minute, 0 for no limit")
+	flag.IntVar(&c.TokensPerMin, "tpm", 0, "maximum estimated LLM tokens per minute, 0 for no limit")
+	flag.BoolVar(&c.Quiet, "quiet", false, "show a spinner instead of echoing the test while it is generated")
+	flag.StringVar(&c.History, "history", HistoryFull, "repair rounds sent to the LLM: full, last-n or summarized")
+	flag.IntVar(&c.HistoryRounds, "history-rounds", 1, "number of repair rounds sent to the LLM with -history last-n")
+	flag.StringVar(&c.Strategy, "strategy", StrategySingle, "shape of the generated test: single, table or property")
+	flag.StringVar(&c.Kind, "kind", string(KindTest), "kind of the generated test function: test, fuzz, bench or example")
+	flag.DurationVar(&c.FuzzTime, "fuzztime", 10*time.Second, "how long a generated fuzz test is fuzzed")
+	flag.StringVar(&c.BenchTime, "benchtime", "500ms", "-benchtime of a generated benchmark, i.e. 1s or 100x")
+	flag.BoolVar(&c.DryRun, "dry-run", false, "print the prompt and its token estimate, without calling the LLM or touching files")
+	flag.BoolVar(&c.DryRunJSON, "dry-run-json", false, "like -dry-run, but print the LLM request as JSON")
+	flag.StringVar(&c.PromptDir, "prompt-dir", "", "directory with prompt templates overriding the defaults and the repository's "+RepoPromptDir)
 
 	flag.Parse()
 
@@ -42,8 +87,12 @@ func (c *Config) flags() error {
 		return fmt.Errorf("missing either of the required flags: -pkg-path, -func-path")
 	}
 
-	if c.FuncName == "" {
-		return fmt.Errorf("missing required flag: -func")
+	if c.FuncName == "" && c.TypeName == "" {
+		return fmt.Errorf("missing either of the required flags: -func, -type")
+	}
+
+	if c.FuncName != "" && c.TypeName != "" {
+		return fmt.Errorf("-func and -type are mutually exclusive")
 	}
 
 	return nil
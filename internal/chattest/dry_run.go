@@ -0,0 +1,72 @@
+package chattest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"pleto.dev/chattest/internal/integrations/llm"
+)
+
+// promptSection is a part of the prompt that is worth measuring on its own.
+type promptSection struct {
+	Name    string
+	Content string
+}
+
+// sections splits what the context sends to the LLM into the instructions,
+// each example test, the definitions of each package, the focal method and the repair rounds.
+func (c *LLMTestContext) sections() []promptSection {
+	var sections []promptSection
+	if len(c.Transcript) > 0 {
+		sections = append(sections, promptSection{Name: "instructions", Content: c.Transcript[0].Content})
+	}
+	for _, example := range c.project.TestFiles[:c.exampleTests] {
+		sections = append(sections, promptSection{Name: "example " + example.File, Content: example.Content})
+	}
+	if c.withDefinitions {
+		for _, defs := range newPackageDefinitions(c.project.FocalMethod.GroupDefinitionsByPackage()) {
+			sections = append(sections, promptSection{Name: "definitions of package " + defs.Package, Content: strings.Join(defs.Bodies, "\n\n")})
+		}
+	}
+	focal := "focal method "
+	if len(c.project.FocalMethod.Members) > 0 {
+		focal = "focal type "
+	}
+	sections = append(sections, promptSection{Name: focal + c.project.FocalMethod.Name, Content: c.project.FocalMethod.Body})
+	for i, message := range c.Messages() {
+		if i > taskIdx {
+			sections = append(sections, promptSection{Name: fmt.Sprintf("repair message %d (%s)", i-taskIdx, message.Role), Content: message.Content})
+		}
+	}
+	return sections
+}
+
+// printDryRun prints the request that would be sent to the LLM, with a token estimate for each section,
+// or only the request as JSON.
+func printDryRun(w io.Writer, generator *LLMTestGenerator, llmContext *LLMTestContext, asJSON bool) error {
+	request := generator.request(llmContext)
+
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(request); err != nil {
+			return fmt.Errorf("encoder.Encode(): %w", err)
+		}
+		return nil
+	}
+
+	for i, message := range request.Messages {
+		fmt.Fprintf(w, "--- message %d: %s, ~%d tokens ---\n", i+1, message.Role, llm.EstimateTokens(message.Content))
+		fmt.Fprintln(w, message.Content)
+	}
+
+	fmt.Fprintln(w, "--- token estimate ---")
+	for _, section := range llmContext.sections() {
+		fmt.Fprintf(w, "  %-40s ~%d\n", section.Name, llm.EstimateTokens(section.Content))
+	}
+	fmt.Fprintf(w, "  %-40s ~%d\n", "total, with message overhead", llm.EstimateRequestTokens(request))
+
+	return nil
+}
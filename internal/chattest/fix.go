@@ -0,0 +1,398 @@
+package chattest
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// maxLocalFixes bounds the fixes applied to a generation, as a fix can reveal the next compile error.
+const maxLocalFixes = 3
+
+var (
+	// i.e. "declared and not used: x", or "x declared and not used" before go1.20
+	unusedVarPattern = regexp.MustCompile(`^(?:declared and not used: (\w+)|(\w+) declared (?:and|but) not used)`)
+	// i.e. `"strings" imported and not used` or `"crypto/rand" imported as crand and not used`
+	unusedImportPattern = regexp.MustCompile(`^"([^"]+)" imported(?: as \w+)? and not used`)
+	noNewVarsPattern    = regexp.MustCompile(`^no new variables on left side of :=`)
+	undefinedVarPattern = regexp.MustCompile(`^undefined: (\w+)$`)
+)
+
+// fixLocally applies the mechanical fixes of the compile errors of the results to a copy of the generation:
+// it removes the unused variables and imports, and uses := and = where they belong.
+// It returns the fixed generation and what was fixed, or no fixes when there's nothing it can fix.
+func fixLocally(llmTest *LLMGeneratedTest, results []*TestRunResult) (*LLMGeneratedTest, []string, error) {
+	var diagnostics []string
+	for _, result := range results {
+		if result.CompileError != "" {
+			diagnostics = append(diagnostics, strings.Split(result.CompileError, "\n")...)
+		}
+	}
+
+	fixed := *llmTest
+	fixed.Tests = slices.Clone(llmTest.Tests)
+	fixed.Helpers = slices.Clone(llmTest.Helpers)
+	fixed.Imports = nil
+
+	var fixes []string
+	for _, imp := range llmTest.Imports {
+		if slices.ContainsFunc(diagnostics, func(line string) bool {
+			match := unusedImportPattern.FindStringSubmatch(line)
+			return match != nil && match[1] == imp.Path
+		}) {
+			fixes = append(fixes, fmt.Sprintf("removed the unused import %q", imp.Path))
+			continue
+		}
+		fixed.Imports = append(fixed.Imports, imp)
+	}
+
+	for i, test := range fixed.Tests {
+		source, applied, err := fixSource(test.Source, diagnostics)
+		if err != nil {
+			return nil, nil, fmt.Errorf("fixSource(): %w", err)
+		}
+		fixed.Tests[i].Source = source
+		fixes = append(fixes, applied...)
+	}
+	for i, helper := range fixed.Helpers {
+		source, applied, err := fixSource(helper.Source, diagnostics)
+		if err != nil {
+			return nil, nil, fmt.Errorf("fixSource(): %w", err)
+		}
+		fixed.Helpers[i].Source = source
+		fixes = append(fixes, applied...)
+	}
+
+	return &fixed, fixes, nil
+}
+
+// fixSource applies the fixes of the diagnostics to the source of a declaration.
+func fixSource(source string, diagnostics []string) (string, []string, error) {
+	target, err := newFixTarget(source)
+	if err != nil {
+		return "", nil, fmt.Errorf("newFixTarget(): %w", err)
+	}
+
+	for _, line := range diagnostics {
+		if match := unusedVarPattern.FindStringSubmatch(line); match != nil {
+			target.unusedVar(match[1] + match[2])
+		} else if noNewVarsPattern.MatchString(line) {
+			target.noNewVars()
+		} else if match := undefinedVarPattern.FindStringSubmatch(line); match != nil {
+			target.undefinedVar(match[1])
+		}
+	}
+
+	fixed, ok := target.fixed()
+	if !ok {
+		return source, nil, nil
+	}
+	return fixed, target.fixes, nil
+}
+
+// withHelperCall returns the source of a helper calling t.Helper() first, so failures are reported at the line of the test.
+func withHelperCall(source string) string {
+	target, err := newFixTarget(source)
+	if err != nil {
+		// go test reports what doesn't parse
+		return source
+	}
+
+	target.helperCall()
+	if fixed, ok := target.fixed(); ok {
+		return fixed
+	}
+	return source
+}
+
+// edit replaces the source between the offsets start and end.
+type edit struct {
+	start, end int
+	text       string
+}
+
+// fixTarget is a declaration type-checked on its own, so its local variables are resolved,
+// along with the edits fixing it.
+type fixTarget struct {
+	src   string
+	fset  *token.FileSet
+	file  *ast.File
+	pkg   *types.Package
+	info  *types.Info
+	used  map[types.Object]bool
+	edits []edit
+	fixes []string
+}
+
+func newFixTarget(source string) (*fixTarget, error) {
+	src := decorateWithPackage(source)
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("parser.ParseFile(): %w", err)
+	}
+
+	info := &types.Info{
+		Defs: make(map[*ast.Ident]types.Object),
+		Uses: make(map[*ast.Ident]types.Object),
+	}
+	// the rest of the package isn't there, so its names are undefined and the errors are ignored
+	config := types.Config{Error: func(error) {}}
+	pkg, _ := config.Check("main", fset, []*ast.File{file}, info)
+
+	used := make(map[types.Object]bool)
+	for _, obj := range info.Uses {
+		used[obj] = true
+	}
+
+	return &fixTarget{src: src, fset: fset, file: file, pkg: pkg, info: info, used: used}, nil
+}
+
+// unusedVar replaces the unused local variables with the name by _,
+// or uses them with _ = name when they're declared with var.
+func (t *fixTarget) unusedVar(name string) {
+	for _, ident := range t.definedIdents() {
+		obj, ok := t.info.Defs[ident].(*types.Var)
+		if ident.Name != name || !ok || obj.IsField() || !t.isLocal(obj) || t.used[obj] {
+			continue
+		}
+
+		path, _ := astutil.PathEnclosingInterval(t.file, ident.Pos(), ident.End())
+		if len(path) < 2 {
+			continue
+		}
+		switch parent := path[1].(type) {
+		case *ast.AssignStmt:
+			if !t.replace(ident.Pos(), ident.End(), "_") {
+				continue
+			}
+			if parent.Tok == token.DEFINE && t.allBlank(parent.Lhs, ident) {
+				t.replace(parent.TokPos, parent.TokPos+2, "=")
+			}
+			t.fixes = append(t.fixes, fmt.Sprintf("replaced the unused variable %s by _", name))
+		case *ast.RangeStmt:
+			if !t.replace(ident.Pos(), ident.End(), "_") {
+				continue
+			}
+			if parent.Tok == token.DEFINE && t.allBlank([]ast.Expr{parent.Key, parent.Value}, ident) {
+				t.replace(parent.TokPos, parent.TokPos+2, "=")
+			}
+			t.fixes = append(t.fixes, fmt.Sprintf("replaced the unused variable %s by _", name))
+		case *ast.ValueSpec:
+			if len(path) < 4 {
+				continue
+			}
+			if declStmt, ok := path[3].(*ast.DeclStmt); ok && t.replace(declStmt.End(), declStmt.End(), "\n_ = "+name) {
+				t.fixes = append(t.fixes, fmt.Sprintf("used the unused variable %s with _ = %s", name, name))
+			}
+		}
+	}
+}
+
+// noNewVars replaces := by = where it declares no new variable.
+func (t *fixTarget) noNewVars() {
+	ast.Inspect(t.file, func(n ast.Node) bool {
+		switch stmt := n.(type) {
+		case *ast.AssignStmt:
+			if stmt.Tok == token.DEFINE && !t.declaresNew(stmt.Lhs) && t.replace(stmt.TokPos, stmt.TokPos+2, "=") {
+				t.fixes = append(t.fixes, "replaced := by = where no new variable is declared")
+			}
+		case *ast.RangeStmt:
+			if stmt.Tok == token.DEFINE && !t.declaresNew([]ast.Expr{stmt.Key, stmt.Value}) && t.replace(stmt.TokPos, stmt.TokPos+2, "=") {
+				t.fixes = append(t.fixes, "replaced := by = where no new variable is declared")
+			}
+		}
+		return true
+	})
+}
+
+// undefinedVar replaces = by := at the first assignment to the undefined name,
+// when the other variables it assigns are local or undefined too, so none of them is shadowed.
+func (t *fixTarget) undefinedVar(name string) {
+	var found *ast.AssignStmt
+	ast.Inspect(t.file, func(n ast.Node) bool {
+		stmt, ok := n.(*ast.AssignStmt)
+		if found != nil || !ok || stmt.Tok != token.ASSIGN {
+			return found == nil
+		}
+
+		assigns := false
+		for _, lhs := range stmt.Lhs {
+			ident, ok := lhs.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			obj, resolved := t.info.Uses[ident]
+			switch {
+			case ident.Name == name && !resolved:
+				assigns = true
+			case ident.Name == "_" || !resolved:
+			case !t.isLocal(obj):
+				return true
+			}
+		}
+		if assigns {
+			found = stmt
+		}
+		return true
+	})
+
+	if found != nil && t.replace(found.TokPos, found.TokPos+1, ":=") {
+		t.fixes = append(t.fixes, fmt.Sprintf("declared %s with := instead of =", name))
+	}
+}
+
+// helperCall makes a function taking a *testing.T, B, F or a testing.TB call its Helper method first.
+func (t *fixTarget) helperCall() {
+	fn, ok := t.file.Decls[len(t.file.Decls)-1].(*ast.FuncDecl)
+	if !ok || fn.Body == nil {
+		return
+	}
+
+	param := testingParam(fn)
+	if param == "" {
+		return
+	}
+
+	uses, calls := false, false
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Ident:
+			uses = uses || n.Name == param
+		case *ast.CallExpr:
+			if sel, ok := n.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Helper" {
+				if ident, ok := sel.X.(*ast.Ident); ok && ident.Name == param {
+					calls = true
+				}
+			}
+		}
+		return true
+	})
+	if !uses || calls {
+		return
+	}
+
+	t.replace(fn.Body.Lbrace+1, fn.Body.Lbrace+1, "\n"+param+".Helper()")
+}
+
+// testingParam returns the name of the parameter of the function of type *testing.T, B or F, or testing.TB.
+func testingParam(fn *ast.FuncDecl) string {
+	for _, field := range fn.Type.Params.List {
+		if !isTestingField(field) {
+			continue
+		}
+		for _, name := range field.Names {
+			if name.Name != "_" {
+				return name.Name
+			}
+		}
+	}
+	return ""
+}
+
+// isTestingField tells whether the field is a *testing.T, B or F, or a testing.TB.
+func isTestingField(field *ast.Field) bool {
+	if star, ok := field.Type.(*ast.StarExpr); ok {
+		return isTestingType(star.X, "T", "B", "F")
+	}
+	return isTestingType(field.Type, "TB")
+}
+
+// isTestingType tells whether the expression is one of the named types of the testing package.
+func isTestingType(expr ast.Expr, names ...string) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	return ok && pkg.Name == "testing" && slices.Contains(names, sel.Sel.Name)
+}
+
+// definedIdents returns the identifiers defining objects, in the order of the source.
+func (t *fixTarget) definedIdents() []*ast.Ident {
+	var idents []*ast.Ident
+	for ident, obj := range t.info.Defs {
+		if obj != nil {
+			idents = append(idents, ident)
+		}
+	}
+	sort.Slice(idents, func(i, j int) bool { return idents[i].Pos() < idents[j].Pos() })
+	return idents
+}
+
+// declaresNew tells whether any of the identifiers declares a new variable.
+func (t *fixTarget) declaresNew(exprs []ast.Expr) bool {
+	for _, expr := range exprs {
+		if ident, ok := expr.(*ast.Ident); ok && ident.Name != "_" && t.info.Defs[ident] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// allBlank tells whether the expressions are missing or blank, once replaced is replaced by _.
+func (t *fixTarget) allBlank(exprs []ast.Expr, replaced *ast.Ident) bool {
+	for _, expr := range exprs {
+		if expr == nil || expr == ast.Expr(replaced) {
+			continue
+		}
+		if ident, ok := expr.(*ast.Ident); !ok || ident.Name != "_" {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *fixTarget) isLocal(obj types.Object) bool {
+	return obj.Pkg() != nil && obj.Parent() != nil && obj.Parent() != t.pkg.Scope()
+}
+
+// replace edits the source between the positions, unless another edit already changes it.
+// It tells whether the edit is made.
+func (t *fixTarget) replace(start, end token.Pos, text string) bool {
+	e := edit{start: t.fset.Position(start).Offset, end: t.fset.Position(end).Offset, text: text}
+	for _, other := range t.edits {
+		if e.start < other.end && other.start < e.end || e.start == other.start {
+			return false
+		}
+	}
+	t.edits = append(t.edits, e)
+	return true
+}
+
+// fixed returns the source with the edits applied, or false when there are none
+// or when they break the code, in which case the fix is left for the LLM to do.
+func (t *fixTarget) fixed() (string, bool) {
+	if len(t.edits) == 0 {
+		return "", false
+	}
+
+	content, err := format.Source([]byte(t.apply()))
+	if err != nil {
+		return "", false
+	}
+
+	fixed := strings.TrimPrefix(string(content), decorateWithPackage(""))
+	return strings.Trim(fixed, "\n"), true
+}
+
+// apply returns the source with the edits.
+func (t *fixTarget) apply() string {
+	edits := slices.Clone(t.edits)
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+
+	src := t.src
+	for _, e := range edits {
+		src = src[:e.start] + e.text + src[e.end:]
+	}
+	return src
+}
@@ -0,0 +1,47 @@
+package chattest
+
+import (
+	"go/version"
+	"strings"
+)
+
+// goFeature is a language feature or a standard package tests commonly use, with the Go version introducing it.
+type goFeature struct {
+	version string
+	feature string
+}
+
+var goFeatures = []goFeature{
+	{"go1.18", "generics and the any type"},
+	{"go1.19", "the sync/atomic types such as atomic.Int64"},
+	{"go1.20", "errors.Join"},
+	{"go1.21", "the min, max and clear builtins"},
+	{"go1.21", "the slices, maps, cmp and log/slog packages"},
+	{"go1.22", "range over integers such as for i := range 10"},
+	{"go1.22", "the math/rand/v2 package"},
+	{"go1.23", "range over functions and the iter package"},
+	{"go1.24", "b.Loop, t.Context and t.Chdir"},
+	{"go1.25", "the testing/synctest package and sync.WaitGroup.Go"},
+}
+
+// goLang returns the language version of a go directive, i.e. "go1.21" for "1.21.3", or "" when it's not valid.
+func goLang(goDirective string) string {
+	return version.Lang("go" + strings.TrimPrefix(goDirective, "go"))
+}
+
+// unavailableFeatures returns the features newer than the language version of the go directive,
+// which the tests of the module can't use.
+func unavailableFeatures(goDirective string) []string {
+	lang := goLang(goDirective)
+	if lang == "" {
+		return nil
+	}
+
+	var features []string
+	for _, feature := range goFeatures {
+		if version.Compare(feature.version, lang) > 0 {
+			features = append(features, feature.feature+" ("+strings.TrimPrefix(feature.version, "go")+")")
+		}
+	}
+	return features
+}
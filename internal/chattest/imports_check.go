@@ -0,0 +1,82 @@
+package chattest
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// disallowedImports returns the imports the content adds to the test file at location
+// that are neither in the standard library, the module nor the modules it requires,
+// i.e. a package goimports found in the module cache.
+// The imports the file already had are left alone.
+func disallowedImports(module *Module, location *TestLocation, content []byte) ([]string, error) {
+	if module == nil {
+		return nil, nil
+	}
+
+	existing := make(map[string]bool)
+	src, err := os.ReadFile(location.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("os.ReadFile(): %w", err)
+	}
+	if len(src) > 0 {
+		paths, err := importPaths(src)
+		if err != nil {
+			return nil, fmt.Errorf("importPaths(): %w", err)
+		}
+		for _, path := range paths {
+			existing[path] = true
+		}
+	}
+
+	paths, err := importPaths(content)
+	if err != nil {
+		return nil, fmt.Errorf("importPaths(): %w", err)
+	}
+
+	var disallowed []string
+	for _, path := range paths {
+		if !existing[path] && !module.allows(path) {
+			disallowed = append(disallowed, path)
+		}
+	}
+	return disallowed, nil
+}
+
+// allows tells whether a package of the module can import the package at path without a new requirement.
+func (m *Module) allows(path string) bool {
+	for _, modulePath := range append([]string{m.Path}, m.Requires...) {
+		if path == modulePath || strings.HasPrefix(path, modulePath+"/") {
+			return true
+		}
+	}
+	return isStandardPackage(path)
+}
+
+// isStandardPackage tells whether the import path is in the standard library,
+// whose paths, unlike those of modules, don't start with a domain name.
+func isStandardPackage(path string) bool {
+	first, _, _ := strings.Cut(path, "/")
+	return !strings.Contains(first, ".")
+}
+
+func importPaths(src []byte) ([]string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ImportsOnly)
+	if err != nil {
+		return nil, fmt.Errorf("parser.ParseFile(): %w", err)
+	}
+
+	var paths []string
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return nil, fmt.Errorf("strconv.Unquote(): %w", err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
@@ -0,0 +1,76 @@
+package chattest
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Kind is the kind of test function to generate.
+type Kind string
+
+const (
+	KindTest    Kind = "test"
+	KindFuzz    Kind = "fuzz"
+	KindBench   Kind = "bench"
+	KindExample Kind = "example"
+)
+
+func ParseKind(kind string) (Kind, error) {
+	switch Kind(kind) {
+	case KindTest, KindFuzz, KindBench, KindExample:
+		return Kind(kind), nil
+	}
+	return "", fmt.Errorf("unknown kind %q, expected one of %q, %q, %q, %q", kind, KindTest, KindFuzz, KindBench, KindExample)
+}
+
+// funcPrefix is the prefix go test requires for the names of the functions of this kind.
+func (k Kind) funcPrefix() string {
+	switch k {
+	case KindFuzz:
+		return "Fuzz"
+	case KindBench:
+		return "Benchmark"
+	case KindExample:
+		return "Example"
+	}
+	return "Test"
+}
+
+// signature is how a function of this kind is declared, as it is told to the LLM.
+func (k Kind) signature() string {
+	switch k {
+	case KindFuzz:
+		return "FuzzXxx(f *testing.F)"
+	case KindBench:
+		return "BenchmarkXxx(b *testing.B)"
+	case KindExample:
+		return "ExampleXxx()"
+	}
+	return "TestXxx(t *testing.T)"
+}
+
+// testLocation is the file the generated function is written to.
+// Examples go to example_test.go in the external test package, where they read like user code,
+// the other kinds go to the test file of the focal method's file.
+func (k Kind) testLocation(fm *FocalMethod) *TestLocation {
+	if k != KindExample {
+		return fm.InferTestLocation()
+	}
+	return &TestLocation{
+		Path: filepath.Join(filepath.Dir(fm.File), "example_test.go"),
+		Pkg: Pkg{
+			ID:   fm.Pkg.ID,
+			Name: fm.Pkg.Name + "_test",
+		},
+	}
+}
+
+// validate returns why the generated function can't work as this kind, or "" if it can.
+func (k Kind) validate(test TestFunc) string {
+	// go test compiles an example without an output comment, but never runs it
+	if k == KindExample && !strings.Contains(test.Source, "// Output:") && !strings.Contains(test.Source, "// Unordered output:") {
+		return fmt.Sprintf("%s has no // Output: comment, so go test doesn't run it", test.Name)
+	}
+	return ""
+}
@@ -0,0 +1,267 @@
+package chattest
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"slices"
+	"strings"
+)
+
+var (
+	// failMethods are the methods of testing.T, B and F that report a failure.
+	failMethods = []string{"Error", "Errorf", "Fatal", "Fatalf", "Fail", "FailNow"}
+	skipMethods = []string{"Skip", "Skipf", "SkipNow"}
+	// assertPackages are the assertion libraries whose calls are assertions, i.e. assert.Equal(t, want, got).
+	assertPackages = []string{"assert", "require", "is", "qt"}
+	// equalFuncs are the functions comparing their arguments, i.e. reflect.DeepEqual or cmp.Diff.
+	equalFuncs = []string{"DeepEqual", "Equal", "EqualValues", "Diff", "Same", "Exactly"}
+)
+
+// lintTest returns why the test is worthless even if it passes, or "" if it looks like a real test:
+// it's empty, skipped, asserts nothing, compares a value with itself, synchronizes with time.Sleep,
+// or computes the expected value by calling focal, the function under test, again.
+// focal is nil when the expected values may come from the function under test, i.e. for properties.
+func lintTest(test TestFunc, kind Kind, focal *focalFunc) (string, error) {
+	testFunc, err := parseAST(test.Source, kind)
+	if err != nil {
+		return "", fmt.Errorf("parseAST(): %w", err)
+	}
+
+	if len(testFunc.Body.List) == 0 {
+		return "the test body is empty", nil
+	}
+
+	params := testingParams(testFunc)
+	lint := testLint{params: params, focal: focal, fromFocal: make(map[string]bool)}
+	ast.Inspect(testFunc.Body, lint.inspect)
+
+	var problems []string
+	if skipsUnconditionally(testFunc, params) {
+		problems = append(problems, "the test calls t.Skip, so it never checks anything")
+	}
+	// an example asserts with its output comment, a benchmark measures,
+	// and a fuzz test may only check that the function doesn't panic
+	if !lint.asserts && kind == KindTest {
+		problems = append(problems, "the test asserts nothing, it never calls t.Error, t.Fatal or an assertion helper")
+	}
+	for _, expr := range lint.selfCompared {
+		problems = append(problems, fmt.Sprintf("the test compares %s with itself, which always holds", expr))
+	}
+	if lint.sleeps {
+		problems = append(problems, "the test waits with time.Sleep, which is slow and flaky, synchronize with channels or a sync.WaitGroup instead")
+	}
+	if lint.focalExpected {
+		problems = append(problems, fmt.Sprintf("the test computes the expected value by calling %s again, write the expected value as a literal", focal.name))
+	}
+
+	return strings.Join(problems, "\n"), nil
+}
+
+type testLint struct {
+	// params are the names of the *testing.T, B, F and testing.TB parameters of the test and its function literals.
+	params map[string]bool
+	focal  *focalFunc
+	// fromFocal are the variables assigned a value computed by calling focal.
+	fromFocal map[string]bool
+
+	asserts       bool
+	sleeps        bool
+	focalExpected bool
+	selfCompared  []string
+}
+
+func (l *testLint) inspect(n ast.Node) bool {
+	switch node := n.(type) {
+	case *ast.AssignStmt:
+		if l.focal != nil && slices.ContainsFunc(node.Rhs, l.callsFocal) {
+			for _, lhs := range node.Lhs {
+				if ident, ok := lhs.(*ast.Ident); ok {
+					l.fromFocal[ident.Name] = true
+				}
+			}
+		}
+	case *ast.ValueSpec:
+		if l.focal != nil && slices.ContainsFunc(node.Values, l.callsFocal) {
+			for _, name := range node.Names {
+				l.fromFocal[name.Name] = true
+			}
+		}
+	case *ast.BinaryExpr:
+		if node.Op == token.EQL || node.Op == token.NEQ {
+			l.compared(node.X, node.Y)
+		}
+	case *ast.CallExpr:
+		l.call(node)
+	}
+	return true
+}
+
+func (l *testLint) call(call *ast.CallExpr) {
+	if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+		if recv, ok := sel.X.(*ast.Ident); ok {
+			switch {
+			case l.params[recv.Name] && slices.Contains(failMethods, sel.Sel.Name):
+				l.asserts = true
+			case slices.Contains(assertPackages, recv.Name):
+				l.asserts = true
+			case recv.Name == "time" && sel.Sel.Name == "Sleep":
+				l.sleeps = true
+			}
+		}
+	}
+
+	// the test passes its *testing.T to a helper asserting for it, i.e. check(t, got, want)
+	if slices.ContainsFunc(call.Args, func(arg ast.Expr) bool {
+		ident, ok := arg.(*ast.Ident)
+		return ok && l.params[ident.Name]
+	}) {
+		l.asserts = true
+	}
+
+	if slices.Contains(equalFuncs, funcName(call)) {
+		var args []ast.Expr
+		for _, arg := range call.Args {
+			if ident, ok := arg.(*ast.Ident); !ok || !l.params[ident.Name] {
+				args = append(args, arg)
+			}
+		}
+		// the extra arguments are options or messages, i.e. cmp.Diff(want, got, opts...)
+		if len(args) >= 2 {
+			l.compared(args[0], args[1])
+		}
+	}
+}
+
+// compared records the problems of comparing x and y.
+func (l *testLint) compared(x, y ast.Expr) {
+	if xs := types.ExprString(x); xs == types.ExprString(y) {
+		l.selfCompared = append(l.selfCompared, xs)
+	}
+	if l.focal != nil && l.fromFocalCall(x) && l.fromFocalCall(y) {
+		l.focalExpected = true
+	}
+}
+
+// fromFocalCall tells whether the expression calls focal, or uses a variable assigned by calling it.
+func (l *testLint) fromFocalCall(expr ast.Expr) bool {
+	found := false
+	ast.Inspect(expr, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.CallExpr:
+			found = found || l.focal.calledBy(node)
+		case *ast.Ident:
+			found = found || l.fromFocal[node.Name]
+		}
+		return !found
+	})
+	return found
+}
+
+func (l *testLint) callsFocal(expr ast.Expr) bool {
+	found := false
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok && l.focal.calledBy(call) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// focalFunc is the function under test, as the tests of its package or of the external test package call it.
+type focalFunc struct {
+	name string
+	// pkg is the name of its package, which qualifies it in the external test package.
+	pkg    string
+	method bool
+}
+
+// calledBy tells whether the call calls the function, i.e. Div(a, b) or calc.Div(a, b) but not other.Div(a, b).
+// A method can't be told from the methods of other types without type-checking, any method named like it matches.
+func (f *focalFunc) calledBy(call *ast.CallExpr) bool {
+	fun := call.Fun
+	// i.e. Map[int](values)
+	if index, ok := fun.(*ast.IndexExpr); ok {
+		fun = index.X
+	}
+	switch fun := fun.(type) {
+	case *ast.Ident:
+		return !f.method && fun.Name == f.name
+	case *ast.SelectorExpr:
+		if fun.Sel.Name != f.name {
+			return false
+		}
+		if f.method {
+			return true
+		}
+		pkg, ok := fun.X.(*ast.Ident)
+		return ok && pkg.Name == f.pkg
+	}
+	return false
+}
+
+// skipsUnconditionally tells whether the test calls t.Skip in its body rather than in a condition,
+// i.e. not if testing.Short() { t.Skip() }.
+func skipsUnconditionally(fn *ast.FuncDecl, params map[string]bool) bool {
+	return slices.ContainsFunc(fn.Body.List, func(stmt ast.Stmt) bool {
+		expr, ok := stmt.(*ast.ExprStmt)
+		if !ok {
+			return false
+		}
+		call, ok := expr.X.(*ast.CallExpr)
+		if !ok {
+			return false
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return false
+		}
+		recv, ok := sel.X.(*ast.Ident)
+		return ok && params[recv.Name] && slices.Contains(skipMethods, sel.Sel.Name)
+	})
+}
+
+// testingParams returns the names of the *testing.T, B, F and testing.TB parameters
+// of the function and of the function literals in it, i.e. the t of t.Run(name, func(t *testing.T) {...}).
+func testingParams(fn *ast.FuncDecl) map[string]bool {
+	params := make(map[string]bool)
+	add := func(fields *ast.FieldList) {
+		for _, field := range fields.List {
+			if !isTestingField(field) {
+				continue
+			}
+			for _, name := range field.Names {
+				if name.Name != "_" {
+					params[name.Name] = true
+				}
+			}
+		}
+	}
+
+	add(fn.Type.Params)
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.FuncLit); ok {
+			add(lit.Type.Params)
+		}
+		return true
+	})
+	return params
+}
+
+// funcName returns the name of the called function or method, i.e. "Div" for calc.Div(a, b).
+func funcName(call *ast.CallExpr) string {
+	fun := call.Fun
+	// i.e. Map[int](values)
+	if index, ok := fun.(*ast.IndexExpr); ok {
+		fun = index.X
+	}
+	switch fun := fun.(type) {
+	case *ast.Ident:
+		return fun.Name
+	case *ast.SelectorExpr:
+		return fun.Sel.Name
+	}
+	return ""
+}
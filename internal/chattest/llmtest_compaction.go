@@ -0,0 +1,108 @@
+package chattest
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	HistoryFull       = "full"
+	HistoryLastN      = "last-n"
+	HistorySummarized = "summarized"
+)
+
+// CompactionPolicy decides which part of the transcript is sent to the LLM,
+// so the context doesn't grow without bound over many repair rounds.
+// The transcript always starts with the instructions and the task, then pairs of attempt and feedback.
+type CompactionPolicy interface {
+	Compact(transcript []Message) []Message
+}
+
+func NewCompactionPolicy(history string, rounds int) (CompactionPolicy, error) {
+	switch history {
+	case HistoryFull:
+		return fullHistory{}, nil
+	case HistoryLastN:
+		if rounds < 1 {
+			return nil, fmt.Errorf("history %q needs at least 1 round, got %d", history, rounds)
+		}
+		return lastRounds{n: rounds}, nil
+	case HistorySummarized:
+		return summarizedHistory{}, nil
+	}
+	return nil, fmt.Errorf("unknown history %q, expected one of %q, %q, %q", history, HistoryFull, HistoryLastN, HistorySummarized)
+}
+
+// fullHistory sends the whole transcript.
+type fullHistory struct{}
+
+func (fullHistory) Compact(transcript []Message) []Message {
+	return transcript
+}
+
+// lastRounds sends the task and the last n attempts with their feedback.
+type lastRounds struct {
+	n int
+}
+
+func (p lastRounds) Compact(transcript []Message) []Message {
+	task, rounds := splitTranscript(transcript)
+	if len(rounds) > 2*p.n {
+		rounds = rounds[len(rounds)-2*p.n:]
+	}
+	return concatMessages(task, rounds)
+}
+
+// summarizedHistory sends the task, a digest of the errors of the earlier rounds,
+// and the latest attempt with its feedback. The superseded tests are dropped.
+type summarizedHistory struct{}
+
+func (summarizedHistory) Compact(transcript []Message) []Message {
+	task, rounds := splitTranscript(transcript)
+	if len(rounds) <= 2 {
+		return transcript
+	}
+
+	earlier, latest := rounds[:len(rounds)-2], rounds[len(rounds)-2:]
+
+	var sb strings.Builder
+	sb.WriteString("Your earlier attempts failed with:\n")
+	for i := 1; i < len(earlier); i += 2 {
+		fmt.Fprintf(&sb, "- attempt %d: %s\n", i/2+1, earlier[i].Digest)
+	}
+	sb.WriteString("Don't repeat these mistakes.\n")
+
+	digest := Message{Role: RoleUser, Content: sb.String()}
+	return concatMessages(task, []Message{digest}, latest)
+}
+
+func splitTranscript(transcript []Message) (task, rounds []Message) {
+	if len(transcript) <= taskIdx+1 {
+		return transcript, nil
+	}
+	return transcript[:taskIdx+1], transcript[taskIdx+1:]
+}
+
+func concatMessages(parts ...[]Message) []Message {
+	var messages []Message
+	for _, part := range parts {
+		messages = append(messages, part...)
+	}
+	return messages
+}
+
+// digest summarizes a failure in one short line: the first line of the message, cut to a maximum length.
+func digest(failure string) string {
+	const maxLen = 200
+	line, _, _ := strings.Cut(strings.TrimSpace(failure), "\n")
+	if len(line) > maxLen {
+		// cut before the rune the maximum length falls in, not in the middle of it
+		cut := maxLen
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		line = line[:cut] + "..."
+	}
+	return line
+}
@@ -1,143 +1,202 @@
 package chattest
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
 
-// LLMTestContext keeps the prompts used to generate the test.
-// InitialPrompt is self-explanatory.
-// In FollowUps are the prompts used to repair the generated test.
-type LLMTestContext struct {
-	InitialPrompt string
-	FollowUps     []string
-}
+type Role string
 
-func NewLLMTestContext() *LLMTestContext {
-	return &LLMTestContext{}
-}
+const (
+	RoleSystem    Role = "system"
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+)
 
-func (c *LLMTestContext) AddTestPrompt(project *Project) {
-	c.InitialPrompt = c.testPrompt(project)
+type Message struct {
+	Role    Role
+	Content string
+	// Digest is a one line summary of a feedback message, used when the transcript is compacted.
+	Digest string
 }
 
-func (c *LLMTestContext) testPrompt(project *Project) string {
-	return newTestPromptBuilder().
-		addTests(project.TestFiles).
-		addDefinitions(project.FocalMethod.GroupDefinitionsByPackage()).
-		addFocalMethod(project.FocalMethod).
-		addInstructions().
-		build()
+// LLMTestContext keeps the conversation used to generate the test.
+// The Transcript starts with the system instructions and the user task,
+// followed by the assistant's attempts, each answered with the user's feedback.
+type LLMTestContext struct {
+	Transcript []Message
+	Compaction CompactionPolicy
+	Prompts    *Prompts
+	Strategy   Strategy
+	Kind       Kind
+	// Tests is the number of tests asked for.
+	Tests int
+
+	project *Project
+	style   StyleProfile
+	// exampleTests and withDefinitions select the optional sections of the task,
+	// Shrink reduces them when the transcript doesn't fit the model's context.
+	exampleTests    int
+	withDefinitions bool
+}
+
+// taskIdx is the position of the user task in the transcript, right after the system instructions.
+const taskIdx = 1
+
+func NewLLMTestContext(compaction CompactionPolicy, prompts *Prompts, strategy Strategy, kind Kind, tests int) *LLMTestContext {
+	return &LLMTestContext{
+		Compaction: compaction,
+		Prompts:    prompts,
+		Strategy:   strategy,
+		Kind:       kind,
+		Tests:      tests,
+	}
 }
 
-type testPromptBuilder struct {
-	sb strings.Builder
+// Messages returns the transcript compacted by the CompactionPolicy, as it should be sent to the LLM.
+func (c *LLMTestContext) Messages() []Message {
+	return c.Compaction.Compact(c.Transcript)
 }
 
-func newTestPromptBuilder() *testPromptBuilder {
-	return &testPromptBuilder{}
-}
+func (c *LLMTestContext) AddTestPrompt(project *Project) error {
+	c.project = project
+	c.style = newStyleProfile(project.TestFiles)
+	c.exampleTests = len(project.TestFiles)
+	c.withDefinitions = true
 
-func (b *testPromptBuilder) addTests(tests []*ExampleTestFile) *testPromptBuilder {
-	if len(tests) == 0 {
-		return b
+	data := InstructionsData{
+		Kind:     string(c.Kind),
+		Strategy: c.Strategy.Name(),
+		Tests:    c.Tests,
+		Style:    c.style,
 	}
-	b.sb.WriteString("Using these tests as example:\n")
-	b.sb.WriteString(sprintTests(tests))
-	b.sb.WriteString("\n\n")
-	return b
-}
-
-func (b *testPromptBuilder) addDefinitions(defs map[string][]Definition) *testPromptBuilder {
-	if len(defs) == 0 {
-		return b
+	if project.Module != nil {
+		data.GoVersion = project.Module.GoVersion
+		data.Toolchain = project.Module.Toolchain
+		data.UnavailableFeatures = unavailableFeatures(project.Module.GoVersion)
 	}
-	b.sb.WriteString("Given:\n")
-	b.sb.WriteString(sprintDefinitions(defs))
-	b.sb.WriteString("\n")
-	return b
-}
 
-func (b *testPromptBuilder) addFocalMethod(focalMethod *FocalMethod) *testPromptBuilder {
-	b.sb.WriteString("Write a golang test for:\n")
-	b.sb.WriteString("```\n")
-	b.sb.WriteString(focalMethod.Body)
-	b.sb.WriteString("\n")
-	b.sb.WriteString("```\n")
-	return b
-}
+	instructions, err := c.Prompts.Instructions(data)
+	if err != nil {
+		return fmt.Errorf("Prompts.Instructions(): %w", err)
+	}
 
-func (b *testPromptBuilder) addInstructions() *testPromptBuilder {
-	b.sb.WriteString(writeTestInstructions())
-	return b
-}
+	task, err := c.testPrompt()
+	if err != nil {
+		return fmt.Errorf("testPrompt(): %w", err)
+	}
 
-func (b *testPromptBuilder) build() string {
-	return b.sb.String()
+	c.Transcript = []Message{
+		{Role: RoleSystem, Content: instructions},
+		{Role: RoleUser, Content: task},
+	}
+	return nil
 }
 
-func sprintTests(tests []*ExampleTestFile) string {
-	var sb strings.Builder
-	for _, test := range tests {
-		sb.WriteString("```\n")
-		sb.WriteString(test.Content)
-		sb.WriteString("```\n\n")
+func (c *LLMTestContext) testPrompt() (string, error) {
+	var defs []PackageDefinitions
+	if c.withDefinitions {
+		defs = newPackageDefinitions(c.project.FocalMethod.GroupDefinitionsByPackage())
+	}
+	return c.Prompts.Task(TaskData{
+		Kind:        string(c.Kind),
+		Tests:       c.Tests,
+		FocalMethod: c.project.FocalMethod,
+		Definitions: defs,
+		Examples:    c.project.TestFiles[:c.exampleTests],
+		Style:       c.style,
+	})
+}
+
+// Shrink drops the least useful part of the context, so it fits in the model's context window:
+// first the older attempts and their feedback, then the example tests one by one, and at last the definitions.
+// It returns false when there is nothing left to drop.
+func (c *LLMTestContext) Shrink() (bool, error) {
+	// the task, plus the latest attempt and its feedback
+	const minTranscript = taskIdx + 3
+	switch {
+	case len(c.Transcript) > minTranscript:
+		latest := c.Transcript[len(c.Transcript)-2:]
+		c.Transcript = append(c.Transcript[:taskIdx+1], latest...)
+		return true, nil
+	case c.exampleTests > 0:
+		c.exampleTests--
+	case c.withDefinitions:
+		c.withDefinitions = false
+	default:
+		return false, nil
 	}
-	return sb.String()
-}
 
-func sprintDefinitions(defs map[string][]Definition) string {
-	var sb strings.Builder
-	for pkg, defs := range defs {
-		sb.WriteString("```\n")
-		sb.WriteString("package " + pkg + "\n\n")
-		for _, def := range defs {
-			if def.Body() != nil {
-				sb.WriteString(*def.Body())
-				sb.WriteString("\n\n")
-			}
+	task, err := c.testPrompt()
+	if err != nil {
+		return false, fmt.Errorf("testPrompt(): %w", err)
+	}
+	c.Transcript[taskIdx].Content = task
+	return true, nil
+}
+
+// AddRepairPrompt records the assistant's attempt and answers it with the reasons its tests failed.
+// kept are the tests that passed, which are not asked for again,
+// fixes the fixes applied to the attempt before running it again.
+func (c *LLMTestContext) AddRepairPrompt(llmTest *LLMGeneratedTest, testRuns []*TestRunResult, kept []string, fixes []string) error {
+	data := RepairData{KeptTests: kept, LocalFixes: fixes, Style: c.style}
+	for _, testRun := range testRuns {
+		if !testRun.TestFailed {
+			continue
 		}
-		sb.WriteString("```\n\n")
+		data.Failures = append(data.Failures, FeedbackData{
+			Test:              testRun.Name,
+			Rejection:         testRun.Rejection,
+			DisallowedImports: testRun.DisallowedImports,
+			AllowedModules:    testRun.AllowedModules,
+			CompileError:      testRun.CompileError,
+			Suggestions:       testRun.Suggestions,
+			FailedMessage:     testRun.FailedMessage,
+			FailingInput:      testRun.FailingInput,
+			PassedSubtests:    testRun.PassedSubtests,
+			FailedSubtests:    testRun.FailedSubtests,
+			Counterexamples:   testRun.Counterexamples,
+			Style:             c.style,
+		})
 	}
-	return sb.String()
-}
 
-func (c *LLMTestContext) AddRepairPrompt(llmTest *LLMGeneratedTest, testRun *TestRunResult) {
-	if testRun.CompileError != "" {
-		c.FollowUps = append(c.FollowUps, c.compileErrorPrompt(llmTest.Test, testRun.CompileError))
-	}
-	if testRun.FailedMessage != "" {
-		c.FollowUps = append(c.FollowUps, c.runtimeFailMessagePrompt(llmTest.Test, testRun.FailedMessage))
+	feedback, err := c.Prompts.Repair(data)
+	if err != nil {
+		return fmt.Errorf("Prompts.Repair(): %w", err)
 	}
-}
 
-func (c *LLMTestContext) runtimeFailMessagePrompt(llmTest, message string) string {
-	var sb strings.Builder
-	sb.WriteString("The test you generated\n")
-	sb.WriteString(llmTest)
-	sb.WriteString("\n")
-	sb.WriteString("failed with the message:\n")
-	sb.WriteString("```\n")
-	sb.WriteString(message)
-	sb.WriteString("\n")
-	sb.WriteString("```\n")
-	sb.WriteString("Please fix the test.\n")
-	sb.WriteString(writeTestInstructions())
-	return sb.String()
+	c.Transcript = append(c.Transcript, Message{Role: RoleAssistant, Content: llmTest.Response})
+	c.Transcript = append(c.Transcript, Message{
+		Role:    RoleUser,
+		Content: feedback,
+		Digest:  feedbackDigest(testRuns),
+	})
+	return nil
 }
 
-func (c *LLMTestContext) compileErrorPrompt(llmTest, compileError string) string {
-	var sb strings.Builder
-	sb.WriteString("The test you generated\n")
-	sb.WriteString(llmTest)
-	sb.WriteString("\n")
-	sb.WriteString("failed with the compile error:\n")
-	sb.WriteString("```\n")
-	sb.WriteString(compileError)
-	sb.WriteString("\n")
-	sb.WriteString("```\n")
-	sb.WriteString("Please fix the test.\n")
-	sb.WriteString(writeTestInstructions())
-	return sb.String()
+func feedbackDigest(testRuns []*TestRunResult) string {
+	var digests []string
+	for _, testRun := range testRuns {
+		if testRun.TestFailed {
+			digests = append(digests, testRunDigest(testRun))
+		}
+	}
+	return strings.Join(digests, "; ")
 }
 
-func writeTestInstructions() string {
-	return "Don't mock, use fakes. Write only the test, only one, with no imports or explanations.\n"
+func testRunDigest(testRun *TestRunResult) string {
+	var prefix string
+	if testRun.Name != "" {
+		prefix = testRun.Name + " "
+	}
+	if testRun.Rejection != "" {
+		return prefix + "rejected: " + digest(testRun.Rejection)
+	}
+	if len(testRun.DisallowedImports) > 0 {
+		return prefix + "disallowed imports: " + strings.Join(testRun.DisallowedImports, ", ")
+	}
+	if testRun.CompileError != "" {
+		return prefix + "compile error: " + digest(testRun.CompileError)
+	}
+	return prefix + "test failure: " + digest(testRun.FailedMessage)
 }
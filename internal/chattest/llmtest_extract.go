@@ -0,0 +1,193 @@
+package chattest
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strings"
+)
+
+var (
+	// fencePattern matches the opening and closing lines of a Markdown code block,
+	// i.e. "```go", "``` go title", "~~~golang" or a bare "```".
+	fencePattern = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})\\s*([^`]*)$")
+	// declPattern matches the lines a top-level Go declaration can start at.
+	declPattern = regexp.MustCompile(`^(?:(?:func|type|var|const|import)\b|//)`)
+)
+
+// extractTest returns the code of the response that declares the function of the given kind.
+// It joins the code blocks that parse as Go declarations, as the LLM may put the fakes and each test in its own block.
+// When they don't declare one together, it picks the last code block declaring one and, when no block does,
+// falls back to the longest region of the response that parses as Go declarations.
+func extractTest(response string, kind Kind) (string, error) {
+	blocks := codeBlocks(response)
+
+	if code, found := joinBlocks(blocks, kind); found {
+		return code, nil
+	}
+
+	var parseErr error
+	for i := len(blocks) - 1; i >= 0; i-- {
+		code := stripPackageClause(blocks[i])
+		if !declaresKind(code, kind) {
+			continue
+		}
+		if _, err := parseAST(code, kind); err != nil {
+			if parseErr == nil {
+				parseErr = err
+			}
+			continue
+		}
+		return code, nil
+	}
+
+	if code, found := longestGoRegion(response, kind); found {
+		return code, nil
+	}
+
+	switch {
+	case parseErr != nil:
+		return "", fmt.Errorf("the code block declaring the %s doesn't parse: %w", kind.signature(), parseErr)
+	case len(blocks) > 0:
+		return "", fmt.Errorf("none of the %d code blocks of the response declares a %s", len(blocks), kind.signature())
+	}
+	return "", errors.New("the response has no code block nor Go code")
+}
+
+// joinBlocks joins the code blocks that parse as Go declarations into one piece of code, their imports first,
+// if it declares a function of the given kind. The tests declared again are deduped by parseParts.
+func joinBlocks(blocks []string, kind Kind) (string, bool) {
+	var imports, decls strings.Builder
+	for _, block := range blocks {
+		code := stripPackageClause(block)
+		src := decorateWithPackage(code)
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+		if err != nil {
+			continue
+		}
+
+		// the imports must come before the other declarations of the joined code
+		importsEnd := len(decorateWithPackage(""))
+		for _, decl := range file.Decls {
+			if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.IMPORT {
+				importsEnd = fset.Position(decl.End()).Offset
+			}
+		}
+		imports.WriteString(src[len(decorateWithPackage("")):importsEnd] + "\n")
+		decls.WriteString(src[importsEnd:] + "\n")
+	}
+
+	code := imports.String() + decls.String()
+	if !declaresKind(code, kind) {
+		return "", false
+	}
+	if _, err := parseAST(code, kind); err != nil {
+		return "", false
+	}
+	return code, true
+}
+
+// codeBlocks returns the code of the fenced code blocks of a Markdown text, in order.
+// A block left open by a truncated response runs until the end of the text.
+func codeBlocks(text string) []string {
+	var blocks []string
+	var fence string
+	var code strings.Builder
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		match := fencePattern.FindStringSubmatch(line)
+
+		if fence == "" {
+			if match != nil {
+				fence = match[1]
+				code.Reset()
+			}
+			continue
+		}
+
+		// a closing fence uses the same character as the opening one, at least as many times, and has no info string
+		if match != nil && match[2] == "" && match[1][0] == fence[0] && len(match[1]) >= len(fence) {
+			blocks = append(blocks, code.String())
+			fence = ""
+			continue
+		}
+		code.WriteString(line)
+		code.WriteString("\n")
+	}
+
+	if fence != "" {
+		blocks = append(blocks, code.String())
+	}
+	return blocks
+}
+
+// longestGoRegion returns the longest run of lines of the text that parses as Go declarations
+// and declares a function of the given kind. Declarations start and end at unindented lines.
+func longestGoRegion(text string, kind Kind) (string, bool) {
+	lines := strings.Split(text, "\n")
+
+	// only the lines a declaration can end at are tried as the end of a region, not the lines of prose
+	var ends []int
+	for i, line := range lines {
+		if endsDecl(line) {
+			ends = append(ends, i)
+		}
+	}
+
+	var longest string
+	for start := range lines {
+		if !declPattern.MatchString(lines[start]) {
+			continue
+		}
+		for i := len(ends) - 1; i >= 0 && ends[i] >= start; i-- {
+			end := ends[i]
+			region := strings.Join(lines[start:end+1], "\n") + "\n"
+			if len(region) <= len(longest) {
+				break
+			}
+			if !declaresKind(region, kind) {
+				break
+			}
+			if _, err := parseAST(region, kind); err == nil {
+				longest = region
+				break
+			}
+		}
+	}
+
+	return longest, longest != ""
+}
+
+// endsDecl tells whether a top-level declaration can end at the line:
+// it closes a block, i.e. "}" or ")", or it's a declaration on a single line, i.e. "type ID int".
+func endsDecl(line string) bool {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "}" || line == ")" {
+		return true
+	}
+	return declPattern.MatchString(line) && !strings.HasPrefix(line, "//") &&
+		!strings.HasSuffix(line, "{") && !strings.HasSuffix(line, "(")
+}
+
+// declaresKind tells whether the code seems to declare a function of the given kind, without parsing it.
+func declaresKind(code string, kind Kind) bool {
+	return strings.Contains(code, "func "+kind.funcPrefix())
+}
+
+// stripPackageClause removes the package clause the LLM sometimes writes despite being asked not to,
+// as the code is parsed and saved into an existing file.
+func stripPackageClause(code string) string {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", code, parser.PackageClauseOnly)
+	if err != nil || file.Name == nil || file.Name.Name == "" {
+		return code
+	}
+
+	end := fset.Position(file.Name.End()).Offset
+	return strings.TrimLeft(code[end:], "\n")
+}
@@ -9,42 +9,47 @@ import (
 
 // LLMTestGenerator uses the prompts from LLMTestContext to generate a test using the LLM API.
 // It returns the parsed generated test.
+// If onDelta is set, the completion is streamed to it while it is generated.
 type LLMTestGenerator struct {
-	llm llm.LLM
+	llm     llm.LLM
+	model   string
+	onDelta func(delta string)
 }
 
-func NewLLMTestGenerator(llm llm.LLM) *LLMTestGenerator {
+func NewLLMTestGenerator(llm llm.LLM, model string, onDelta func(delta string)) *LLMTestGenerator {
 	return &LLMTestGenerator{
 		llm,
+		model,
+		onDelta,
 	}
 }
 
 func (t *LLMTestGenerator) Generate(ctx context.Context, context *LLMTestContext) (*LLMGeneratedTest, error) {
-	request := llm.CreateChatCompletionRequest{
-		Messages: []llm.ChatCompletionMessage{
-			{
-				Role:    "system",
-				Content: context.InitialPrompt,
-			},
-		},
-	}
-
-	for _, followUp := range context.FollowUps {
-		request.Messages = append(request.Messages, llm.ChatCompletionMessage{
-			Role:    "user",
-			Content: followUp,
-		})
-	}
-
-	response, err := t.llm.CreateChatCompletion(ctx, &request)
+	response, err := llm.Stream(ctx, t.llm, t.request(context), t.onDelta)
 	if err != nil {
-		return nil, fmt.Errorf("t.llm.CreateChatCompletion(): %w", err)
+		return nil, fmt.Errorf("llm.Stream(): %w", err)
 	}
 
-	llmTest, err := parse(response.Content)
+	llmTest, err := parse(response.Content, context.Kind)
 	if err != nil {
 		return nil, fmt.Errorf("parse(): %w", err)
 	}
+	llmTest.Cached = response.Cached
 
 	return llmTest, nil
 }
+
+func (t *LLMTestGenerator) request(context *LLMTestContext) *llm.CreateChatCompletionRequest {
+	request := &llm.CreateChatCompletionRequest{
+		Model: t.model,
+	}
+
+	for _, message := range context.Messages() {
+		request.Messages = append(request.Messages, llm.ChatCompletionMessage{
+			Role:    string(message.Role),
+			Content: message.Content,
+		})
+	}
+
+	return request
+}
@@ -5,44 +5,165 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"strconv"
 	"strings"
 )
 
 type LLMGeneratedTest struct {
+	// Tests are the test functions, in the order they were generated.
+	Tests []TestFunc
+	// Helpers are the other declarations the tests need, i.e. fakes and helper functions.
+	Helpers []Decl
+	// Imports are the imports the tests asked for, goimports adds the ones they forgot.
+	Imports []Import
+	// Response is the LLM answer the test was extracted from, as it was received.
+	Response string
+	// Cached is set when the LLM response was served from the response cache.
+	Cached bool
+}
+
+// TestFunc is a generated test function.
+type TestFunc struct {
+	Name string
+	// Source is the source of the function, with its doc comment.
+	Source string
+}
+
+// Decl is a top-level declaration emitted along with the tests.
+type Decl struct {
+	// Names are the names it declares, see declNames.
+	Names  []string
+	Source string
+}
+
+type Import struct {
+	// Name is the name the package is imported as, or "" for its own name.
 	Name string
-	Test string
+	Path string
 }
 
-func parse(llmTest string) (*LLMGeneratedTest, error) {
-	test := extractTest(llmTest)
-	ast, err := parseAST(test)
+func parse(llmTest string, kind Kind) (*LLMGeneratedTest, error) {
+	code, err := extractTest(llmTest, kind)
 	if err != nil {
-		return nil, fmt.Errorf("parseAST(): %w", err)
+		return nil, fmt.Errorf("extractTest(): %w", err)
 	}
 
-	return &LLMGeneratedTest{
-		Name: ast.Name.Name,
-		Test: test,
-	}, nil
+	test, err := parseParts(code, kind)
+	if err != nil {
+		return nil, fmt.Errorf("parseParts(): %w", err)
+	}
+
+	test.Response = llmTest
+	return test, nil
 }
 
-func extractTest(llmTest string) string {
-	llmTest = strings.TrimSpace(llmTest)
+// parseParts splits the code into the test functions, the declarations they need and their imports.
+// When two test functions or two helpers have the same names, the last one is kept,
+// i.e. a fake repeated in several code blocks.
+func parseParts(code string, kind Kind) (*LLMGeneratedTest, error) {
+	if _, err := parseAST(code, kind); err != nil {
+		return nil, fmt.Errorf("parseAST(): %w", err)
+	}
 
-	preffixesToTrim := []string{"```golang", "```go", "```"}
-	for _, preffix := range preffixesToTrim {
-		llmTest = strings.TrimPrefix(llmTest, preffix)
+	src := decorateWithPackage(code)
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("parser.ParseFile(): %w", err)
 	}
 
-	suffixesToTrim := []string{"```"}
-	for _, suffix := range suffixesToTrim {
-		llmTest = strings.TrimSuffix(llmTest, suffix)
+	test := &LLMGeneratedTest{}
+	testIdx := make(map[string]int)
+	helperIdx := make(map[string]int)
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return nil, fmt.Errorf("strconv.Unquote(): %w", err)
+		}
+		imp := Import{Path: path}
+		if spec.Name != nil {
+			imp.Name = spec.Name.Name
+		}
+		test.Imports = append(test.Imports, imp)
 	}
 
-	return llmTest
+	for _, decl := range file.Decls {
+		if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.IMPORT {
+			continue
+		}
+
+		source := declSource(fset, src, decl)
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && strings.HasPrefix(fn.Name.Name, kind.funcPrefix()) {
+			testFunc := TestFunc{Name: fn.Name.Name, Source: source}
+			if i, found := testIdx[testFunc.Name]; found {
+				test.Tests[i] = testFunc
+				continue
+			}
+			testIdx[testFunc.Name] = len(test.Tests)
+			test.Tests = append(test.Tests, testFunc)
+			continue
+		}
+		helper := Decl{Names: declNames(decl), Source: source}
+		key := strings.Join(helper.Names, ",")
+		if i, found := helperIdx[key]; found && key != "" {
+			test.Helpers[i] = helper
+			continue
+		}
+		helperIdx[key] = len(test.Helpers)
+		test.Helpers = append(test.Helpers, helper)
+	}
+
+	return test, nil
+}
+
+// declSource returns the source of the declaration, with its doc comment.
+func declSource(fset *token.FileSet, src string, decl ast.Decl) string {
+	start := decl.Pos()
+	if doc := declDoc(decl); doc != nil {
+		start = doc.Pos()
+	}
+	return src[fset.Position(start).Offset:fset.Position(decl.End()).Offset]
+}
+
+func declDoc(decl ast.Decl) *ast.CommentGroup {
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		return decl.Doc
+	case *ast.GenDecl:
+		return decl.Doc
+	}
+	return nil
+}
+
+// declNames returns the names a top-level declaration declares.
+// A method is named after its receiver type, i.e. "fakeStore.Get", as methods of different types can share a name.
+func declNames(decl ast.Decl) []string {
+	var names []string
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		if recv := getReceiverName(decl); recv != "" {
+			return []string{recv + "." + decl.Name.Name}
+		}
+		names = append(names, decl.Name.Name)
+	case *ast.GenDecl:
+		for _, spec := range decl.Specs {
+			switch spec := spec.(type) {
+			case *ast.TypeSpec:
+				names = append(names, spec.Name.Name)
+			case *ast.ValueSpec:
+				for _, name := range spec.Names {
+					if name.Name != "_" {
+						names = append(names, name.Name)
+					}
+				}
+			}
+		}
+	}
+	return names
 }
 
-func parseAST(test string) (*ast.FuncDecl, error) {
+// parseAST returns the last function of the given kind, i.e. the last BenchmarkXxx for KindBench.
+func parseAST(test string, kind Kind) (*ast.FuncDecl, error) {
 	// we need to add a dummy package declaration to use go/parser
 	test = decorateWithPackage(test)
 
@@ -56,8 +177,8 @@ func parseAST(test string) (*ast.FuncDecl, error) {
 	var testFunc *ast.FuncDecl
 	ast.Inspect(node, func(n ast.Node) bool {
 		if fn, ok := n.(*ast.FuncDecl); ok {
-			// in golang, tests are functions whose names begin with Test
-			if strings.HasPrefix(fn.Name.Name, "Test") {
+			// in golang, tests are functions whose names begin with Test, fuzz tests with Fuzz, benchmarks with Benchmark
+			if strings.HasPrefix(fn.Name.Name, kind.funcPrefix()) {
 				testFunc = fn
 			}
 		}
@@ -65,7 +186,7 @@ func parseAST(test string) (*ast.FuncDecl, error) {
 	})
 
 	if testFunc == nil {
-		return nil, fmt.Errorf("test function not found")
+		return nil, fmt.Errorf("%s function not found", kind.signature())
 	}
 	return testFunc, nil
 }
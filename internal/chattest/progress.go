@@ -0,0 +1,49 @@
+package chattest
+
+import (
+	"fmt"
+	"io"
+)
+
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+// progress shows a completion while the LLM generates it.
+// It echoes the completion to the writer, or in quiet mode it only spins a spinner.
+type progress struct {
+	w       io.Writer
+	quiet   bool
+	frame   int
+	started bool
+}
+
+func newProgress(w io.Writer, quiet bool) *progress {
+	return &progress{
+		w:     w,
+		quiet: quiet,
+	}
+}
+
+func (p *progress) update(delta string) {
+	p.started = true
+	if !p.quiet {
+		fmt.Fprint(p.w, delta)
+		return
+	}
+	fmt.Fprintf(p.w, "\rGenerating %s", spinnerFrames[p.frame%len(spinnerFrames)])
+	p.frame++
+}
+
+// done ends the output of the current completion, so the next one starts on a fresh line.
+func (p *progress) done() {
+	if !p.started {
+		return
+	}
+	if p.quiet {
+		// overwrite the spinner line
+		fmt.Fprint(p.w, "\r            \r")
+	} else {
+		fmt.Fprintln(p.w)
+	}
+	p.started = false
+	p.frame = 0
+}
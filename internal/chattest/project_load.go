@@ -12,6 +12,10 @@ type Project struct {
 	Path        string
 	FocalMethod *FocalMethod
 	TestFiles   []*ExampleTestFile
+	// Packages are the loaded packages of the repository, with their test variants.
+	Packages []*packages.Package
+	// Module is the module of the focal method, nil outside of a module.
+	Module *Module
 }
 
 func LoadPackages(cfg *Config) (*Project, error) {
@@ -23,7 +27,8 @@ func LoadPackages(cfg *Config) (*Project, error) {
 		packages.NeedTypes |
 		packages.NeedSyntax |
 		packages.NeedTypesInfo |
-		packages.NeedTypesSizes
+		packages.NeedTypesSizes |
+		packages.NeedModule
 
 	pkgsLoadCfg := packages.Config{
 		Mode: loadMode,
@@ -53,10 +58,17 @@ func LoadPackages(cfg *Config) (*Project, error) {
 		return nil, fmt.Errorf("selectRandomTests(): %w", err)
 	}
 
+	module, err := loadModule(pkgs, focalMethod.Pkg)
+	if err != nil {
+		return nil, fmt.Errorf("loadModule(): %w", err)
+	}
+
 	return &Project{
 		FocalMethod: focalMethod,
 		Path:        cfg.RepoPath,
 		TestFiles:   tests,
+		Packages:    pkgs,
+		Module:      module,
 	}, nil
 }
 
@@ -79,9 +79,11 @@ func (f FuncDef) File() *OsPath {
 type TypeDef struct {
 	id   QualifiedName
 	name string
-	pkg  Pkg
-	body string
-	file OsPath
+	// typeName is the name of the type, name the one of the identifier using it the definition is keyed by.
+	typeName string
+	pkg      Pkg
+	body     string
+	file     OsPath
 }
 
 func (s TypeDef) ID() QualifiedName {
@@ -12,8 +12,13 @@ type FocalMethod struct {
 	Body string
 	Pkg  Pkg
 	File OsPath
+	// Recv is the receiver type of a focal method, i.e. "Store" for func (s *Store) Get, "" for a function.
+	Recv string
 	// Uses contains all definitions of the identifiers used in the focal method
 	Uses map[QualifiedName]Definition
+	// Members are the constructors and methods of a focal type, whose Body holds them all.
+	// It is empty for a focal function.
+	Members []string
 }
 
 type TestLocation struct {
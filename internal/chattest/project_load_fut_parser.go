@@ -21,6 +21,9 @@ func (fmp *focalMethodParser) Parse(pkgs []*packages.Package, cfg *Config) (*Foc
 		fmp.pkgsMap[pkg.ID] = pkg
 	}
 
+	if cfg.TypeName != "" {
+		return fmp.findFocalType(cfg.FuncPath, cfg.TypeName)
+	}
 	return fmp.findFocalMethod(cfg.FuncPath, cfg.FuncName)
 }
 
@@ -47,7 +50,8 @@ func (fmp *focalMethodParser) findFocalMethod(funcPath, funcName string) (*Focal
 							Name: pkg.Name,
 						},
 						File: pkg.Fset.File(file.Pos()).Name(),
-						Uses: fmp.extractUses(pkg, decl),
+						Recv: getReceiverName(decl),
+						Uses: fmp.extractUses(pkg, decl.Body),
 					}
 				}
 			}
@@ -57,9 +61,9 @@ func (fmp *focalMethodParser) findFocalMethod(funcPath, funcName string) (*Focal
 	return fut, nil
 }
 
-func (fmp *focalMethodParser) extractUses(pkg *packages.Package, decl *ast.FuncDecl) map[QualifiedName]Definition {
+func (fmp *focalMethodParser) extractUses(pkg *packages.Package, node ast.Node) map[QualifiedName]Definition {
 	uses := make(map[QualifiedName]Definition)
-	ast.Inspect(decl.Body, func(n ast.Node) bool {
+	ast.Inspect(node, func(n ast.Node) bool {
 		if node, ok := n.(*ast.Ident); ok {
 			if obj := pkg.TypesInfo.ObjectOf(node); obj != nil && obj.Pkg() != nil {
 				fmp.processObject(obj, node, uses)
@@ -153,8 +157,9 @@ func (fmp *focalMethodParser) processNamedType(obj types.Object, objType *types.
 	typeDef := findTypeDefinition(p, objType.Obj().Name())
 
 	def := TypeDef{
-		id:   QualifyTypeName(obj.Pkg().Path(), obj.Name()),
-		name: obj.Name(),
+		id:       QualifyTypeName(obj.Pkg().Path(), obj.Name()),
+		name:     obj.Name(),
+		typeName: objType.Obj().Name(),
 		pkg: Pkg{
 			ID:   objType.Obj().Pkg().Path(),
 			Name: objType.Obj().Pkg().Name(),
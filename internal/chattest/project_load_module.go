@@ -0,0 +1,63 @@
+package chattest
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/tools/go/packages"
+)
+
+// Module is the Go module of the package under test, as its go.mod declares it.
+type Module struct {
+	Path string
+	// GoVersion is the version of the go directive, i.e. "1.21.3", the minimum version of the language the module uses.
+	GoVersion string
+	// Toolchain is the version of the toolchain directive, i.e. "go1.22.5", "" when there's none.
+	Toolchain string
+	// Requires are the module paths of the require directives, indirect ones included.
+	Requires []string
+}
+
+// loadModule reads the go.mod of the module of the package pkg.
+// It returns nil when the package doesn't belong to a module.
+func loadModule(pkgs []*packages.Package, pkg Pkg) (*Module, error) {
+	var goMod string
+	for _, loaded := range pkgs {
+		if loaded.PkgPath == pkg.ImportPath() && loaded.Module != nil {
+			goMod = loaded.Module.GoMod
+			break
+		}
+	}
+	if goMod == "" {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(goMod)
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile(): %w", err)
+	}
+
+	// the lax parser skips the toolchain directive, it's only needed for the directives of newer go versions
+	file, err := modfile.Parse(goMod, content, nil)
+	if err != nil {
+		if file, err = modfile.ParseLax(goMod, content, nil); err != nil {
+			return nil, fmt.Errorf("modfile.ParseLax(): %w", err)
+		}
+	}
+
+	module := &Module{}
+	if file.Module != nil {
+		module.Path = file.Module.Mod.Path
+	}
+	if file.Go != nil {
+		module.GoVersion = file.Go.Version
+	}
+	if file.Toolchain != nil {
+		module.Toolchain = file.Toolchain.Name
+	}
+	for _, require := range file.Require {
+		module.Requires = append(module.Requires, require.Mod.Path)
+	}
+	return module, nil
+}
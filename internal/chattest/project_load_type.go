@@ -0,0 +1,139 @@
+package chattest
+
+import (
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// findFocalType collects the declaration of the named type, its constructors and its methods as one focal method,
+// so a whole suite is generated for the type instead of a test for each of its methods.
+// The constructors are the functions of the package returning the type or a pointer to it.
+func (fmp *focalMethodParser) findFocalType(typePath, typeName string) (*FocalMethod, error) {
+	for _, pkg := range fmp.pkgsMap {
+		for _, file := range pkg.Syntax {
+			if pkg.Fset.Position(file.Pos()).Filename != typePath {
+				continue
+			}
+			for _, decl := range file.Decls {
+				if decl, ok := decl.(*ast.GenDecl); ok && decl.Tok == token.TYPE {
+					if typeSpec, ok := findTypeSpec(decl, typeName); ok {
+						return fmp.focalType(pkg, file, typeSpec), nil
+					}
+				}
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("type %s not found in %s", typeName, typePath)
+}
+
+func (fmp *focalMethodParser) focalType(pkg *packages.Package, file *ast.File, typeSpec *ast.TypeSpec) *FocalMethod {
+	typeName := typeSpec.Name.Name
+	typeObj := pkg.TypesInfo.Defs[typeSpec.Name]
+
+	body := &strings.Builder{}
+	body.WriteString("type ")
+	printer.Fprint(body, pkg.Fset, typeSpec)
+
+	uses := fmp.extractUses(pkg, typeSpec.Type)
+	var constructors, methods []string
+	for _, decl := range memberDecls(pkg, typeName, typeObj) {
+		body.WriteString("\n\n")
+		printer.Fprint(body, pkg.Fset, decl)
+
+		for id, def := range fmp.extractUses(pkg, decl.Body) {
+			uses[id] = def
+		}
+		if decl.Recv == nil {
+			constructors = append(constructors, decl.Name.Name)
+		} else {
+			methods = append(methods, decl.Name.Name)
+		}
+	}
+
+	// the members are already in the body, only what they use is a definition
+	pkgPath := typeObj.Pkg().Path()
+	delete(uses, QualifyTypeName(pkgPath, typeName))
+	// the type definitions are keyed by the identifiers using the types, each type is defined once, the focal one not at all
+	defined := map[QualifiedName]bool{QualifyTypeName(pkgPath, typeName): true}
+	ids := make([]QualifiedName, 0, len(uses))
+	for id := range uses {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		def, ok := uses[id].(TypeDef)
+		if !ok {
+			continue
+		}
+		typeID := QualifyTypeName(def.pkg.ID, def.typeName)
+		if defined[typeID] {
+			delete(uses, id)
+		}
+		defined[typeID] = true
+	}
+	for _, name := range constructors {
+		delete(uses, QualifyFuncName(pkgPath, nil, name))
+	}
+	for _, name := range methods {
+		delete(uses, QualifyFuncName(pkgPath, &typeName, name))
+	}
+
+	return &FocalMethod{
+		Name: typeName,
+		Body: body.String(),
+		Pkg: Pkg{
+			ID:   pkg.ID,
+			Name: pkg.Name,
+		},
+		File:    pkg.Fset.File(file.Pos()).Name(),
+		Uses:    uses,
+		Members: append(constructors, methods...),
+	}
+}
+
+// memberDecls returns the constructors and the methods of the type, skipping the test files of the package.
+func memberDecls(pkg *packages.Package, typeName string, typeObj types.Object) []*ast.FuncDecl {
+	var members []*ast.FuncDecl
+	for _, file := range pkg.Syntax {
+		if strings.HasSuffix(pkg.Fset.File(file.Pos()).Name(), "_test.go") {
+			continue
+		}
+		for _, decl := range file.Decls {
+			decl, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			if decl.Recv != nil && getReceiverName(decl) == typeName || decl.Recv == nil && isConstructor(pkg, decl, typeObj) {
+				members = append(members, decl)
+			}
+		}
+	}
+	return members
+}
+
+func isConstructor(pkg *packages.Package, decl *ast.FuncDecl, typeObj types.Object) bool {
+	fn, ok := pkg.TypesInfo.Defs[decl.Name].(*types.Func)
+	if !ok || typeObj == nil {
+		return false
+	}
+
+	results := fn.Type().(*types.Signature).Results()
+	for i := 0; i < results.Len(); i++ {
+		typ := results.At(i).Type()
+		if pointer, ok := typ.(*types.Pointer); ok {
+			typ = pointer.Elem()
+		}
+		if named, ok := typ.(*types.Named); ok && named.Obj() == typeObj {
+			return true
+		}
+	}
+	return false
+}
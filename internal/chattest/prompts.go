@@ -0,0 +1,219 @@
+package chattest
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// The prompts are text/template templates. The defaults are embedded in the binary,
+// and any of them can be overridden by a file with the same name in
+// the .chattest/prompts directory of the repository, or in the -prompt-dir directory.
+//
+//   - instructions.tmpl: the system instructions, executed with InstructionsData
+//   - task.tmpl: the task to write a test for the focal method, executed with TaskData
+//   - repair.tmpl: the answer to a failed attempt, executed with RepairData.
+//     By default it includes feedback.tmpl for each failed test.
+//   - feedback.tmpl: why a test failed, executed with FeedbackData.
+//     By default it includes rejection.tmpl, imports.tmpl, compile_error.tmpl and test_failure.tmpl.
+//
+// Besides the text/template builtins, the templates can use join and trimSpace,
+// which are strings.Join and strings.TrimSpace.
+
+//go:embed prompts/*.tmpl
+var defaultPrompts embed.FS
+
+// RepoPromptDir is where a repository keeps its own prompt templates, relative to its root.
+const RepoPromptDir = ".chattest/prompts"
+
+const (
+	instructionsTemplate = "instructions.tmpl"
+	taskTemplate         = "task.tmpl"
+	repairTemplate       = "repair.tmpl"
+)
+
+// InstructionsData is the data of instructions.tmpl.
+type InstructionsData struct {
+	// Kind is the kind of test function: "test", "fuzz", "bench" or "example".
+	Kind string
+	// Strategy is the name of the strategy, i.e. "single" or "table".
+	Strategy string
+	// Tests is the number of tests asked for.
+	Tests int
+	// GoVersion and Toolchain are the go and toolchain directives of the go.mod of the module, i.e. "1.21.3" and "go1.22.5",
+	// "" when they're unknown. The tests must compile with that version of the language.
+	GoVersion string
+	Toolchain string
+	// UnavailableFeatures are the features newer than GoVersion, i.e. "the min, max and clear builtins (1.21)".
+	UnavailableFeatures []string
+	Style               StyleProfile
+}
+
+// TaskData is the data of task.tmpl.
+type TaskData struct {
+	// Kind is the kind of test function: "test", "fuzz", "bench" or "example".
+	Kind string
+	// Tests is the number of tests asked for.
+	Tests int
+	// FocalMethod is the function under test, i.e. {{.FocalMethod.Name}} and {{.FocalMethod.Body}}.
+	// With -type it is the type under test, whose constructors and methods are {{.FocalMethod.Members}}.
+	FocalMethod *FocalMethod
+	// Definitions are the definitions used by the focal method, grouped by package.
+	Definitions []PackageDefinitions
+	// Examples are the test files picked from the repository, i.e. {{.File}} and {{.Content}}.
+	Examples []*ExampleTestFile
+	Style    StyleProfile
+}
+
+// PackageDefinitions are the source code of the definitions declared in the same package.
+type PackageDefinitions struct {
+	Package string
+	Bodies  []string
+}
+
+// RepairData is the data of repair.tmpl.
+type RepairData struct {
+	// Failures are why the tests of the attempt failed, one for each failed test.
+	Failures []FeedbackData
+	// KeptTests are the tests that passed, they are kept as they are.
+	KeptTests []string
+	// LocalFixes are the fixes applied to the attempt without the LLM, i.e. "replaced the unused variable x by _".
+	LocalFixes []string
+	Style      StyleProfile
+}
+
+// FeedbackData is the data of feedback.tmpl.
+// Only one of Rejection, DisallowedImports, CompileError and FailedMessage is usually set.
+type FeedbackData struct {
+	// Test is the name of the failed test, or "" when all the tests failed for the same reason,
+	// i.e. they don't compile.
+	Test      string
+	Rejection string
+	// DisallowedImports are the imports of packages the module doesn't depend on,
+	// AllowedModules the modules the test can import the packages of, besides the standard library.
+	DisallowedImports []string
+	AllowedModules    []string
+	CompileError      string
+	// Suggestions are the real symbols closest to the names the compile error reports undefined.
+	Suggestions   []Suggestion
+	FailedMessage string
+	// FailingInput is the input the fuzzer found to make the fuzz test fail, as saved in testdata/fuzz.
+	FailingInput string
+	// PassedSubtests and FailedSubtests are the subtests of the failed test, as "TestX/name".
+	PassedSubtests []string
+	FailedSubtests []string
+	// Counterexamples are the shrunk inputs that broke the properties of a property test, by subtest.
+	Counterexamples map[string]string
+	Style           StyleProfile
+}
+
+// StyleProfile describes how the example tests are written, so the prompts can ask for the same style.
+type StyleProfile struct {
+	UsesTestify bool
+	TableDriven bool
+	Parallel    bool
+}
+
+func newStyleProfile(examples []*ExampleTestFile) StyleProfile {
+	var style StyleProfile
+	for _, example := range examples {
+		style.UsesTestify = style.UsesTestify || strings.Contains(example.Content, "github.com/stretchr/testify")
+		style.TableDriven = style.TableDriven || strings.Contains(example.Content, "t.Run(")
+		style.Parallel = style.Parallel || strings.Contains(example.Content, "t.Parallel()")
+	}
+	return style
+}
+
+func newPackageDefinitions(defs map[string][]Definition) []PackageDefinitions {
+	var result []PackageDefinitions
+	for pkg, defs := range defs {
+		// the map order is random, but the prompt should be the same on every run;
+		// a copy is sorted, the slices belong to the caller
+		defs := slices.Clone(defs)
+		sort.Slice(defs, func(i, j int) bool {
+			return defs[i].ID() < defs[j].ID()
+		})
+		pkgDefs := PackageDefinitions{Package: pkg}
+		for _, def := range defs {
+			if def.Body() != nil && *def.Body() != "" {
+				pkgDefs.Bodies = append(pkgDefs.Bodies, *def.Body())
+			}
+		}
+		result = append(result, pkgDefs)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Package < result[j].Package
+	})
+	return result
+}
+
+var templateFuncs = template.FuncMap{
+	"join":      strings.Join,
+	"trimSpace": strings.TrimSpace,
+}
+
+type Prompts struct {
+	templates *template.Template
+}
+
+// LoadPrompts parses the default templates, then the templates of each directory in order,
+// each overriding the ones with the same name. Directories that don't exist are skipped.
+func LoadPrompts(dirs ...string) (*Prompts, error) {
+	templates, err := template.New("").Funcs(templateFuncs).ParseFS(defaultPrompts, "prompts/*.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("template.ParseFS(): %w", err)
+	}
+
+	for _, dir := range dirs {
+		if dir == "" || !fileExists(dir) {
+			continue
+		}
+
+		files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+		if err != nil {
+			return nil, fmt.Errorf("filepath.Glob(): %w", err)
+		}
+		if len(files) == 0 {
+			continue
+		}
+
+		if templates, err = templates.ParseFiles(files...); err != nil {
+			return nil, fmt.Errorf("templates.ParseFiles(): %w", err)
+		}
+	}
+
+	return &Prompts{templates: templates}, nil
+}
+
+// loadPrompts loads the templates of the repository under test and of the -prompt-dir directory.
+func loadPrompts(cfg *Config) (*Prompts, error) {
+	if cfg.PromptDir != "" && !fileExists(cfg.PromptDir) {
+		return nil, fmt.Errorf("prompt directory %s: %w", cfg.PromptDir, os.ErrNotExist)
+	}
+	return LoadPrompts(filepath.Join(cfg.RepoPath, RepoPromptDir), cfg.PromptDir)
+}
+
+func (p *Prompts) Instructions(data InstructionsData) (string, error) {
+	return p.execute(instructionsTemplate, data)
+}
+
+func (p *Prompts) Task(data TaskData) (string, error) {
+	return p.execute(taskTemplate, data)
+}
+
+func (p *Prompts) Repair(data RepairData) (string, error) {
+	return p.execute(repairTemplate, data)
+}
+
+func (p *Prompts) execute(name string, data any) (string, error) {
+	var sb strings.Builder
+	if err := p.templates.ExecuteTemplate(&sb, name, data); err != nil {
+		return "", fmt.Errorf("ExecuteTemplate(%s): %w", name, err)
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,120 @@
+package chattest
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Report summarizes what happened during a Run.
+type Report struct {
+	// Generations is the number of tests requested from the LLM, including repairs.
+	Generations int
+	// CacheHits is how many of the Generations were served from the response cache.
+	CacheHits int
+	// TypeCheckFailures is how many generations had compile errors found before running go test.
+	TypeCheckFailures int
+	// SavedRounds is how many repair rounds were saved by fixing compile errors locally, without the LLM,
+	// that is how many generations passed only once fixed.
+	SavedRounds int
+	// FailingInputs are the inputs the fuzzer found to make a generated fuzz test fail, saved under testdata/fuzz.
+	FailingInputs []OsPath
+	// Benchmark is the measurement of the generated benchmark, once it ran successfully.
+	Benchmark *BenchmarkResult
+	// Tests is the number of generated tests, PassedTests how many of them passed.
+	Tests       int
+	PassedTests int
+	// Renamed are the new names of the generated tests named like a hand-written test, by generated name.
+	Renamed map[string]string
+	// SupportFiles are the files the generated tests depend on, written next to them and rewritten on every run.
+	SupportFiles []OsPath
+	// Properties are the properties checked by the last run of a property test.
+	Properties []PropertyResult
+	Passed     bool
+}
+
+type PropertyResult struct {
+	// Name is the subtest checking the property, as "TestX/name".
+	Name string
+	Held bool
+	// Counterexample is the shrunk input the property failed on, if it didn't hold.
+	Counterexample string
+}
+
+func (r *Report) addGeneration(llmTest *LLMGeneratedTest) {
+	r.Generations++
+	if llmTest.Cached {
+		r.CacheHits++
+	}
+}
+
+func (r *Report) addResults(results []*TestRunResult, tests *GeneratedTests, strategy Strategy) {
+	for _, result := range results {
+		r.addResult(result, strategy)
+	}
+	r.Tests = len(tests.Passed) + len(tests.Failing)
+	r.PassedTests = len(tests.Passed)
+	r.Renamed = tests.Renamed
+	r.SupportFiles = tests.SupportFiles
+}
+
+func (r *Report) addResult(result *TestRunResult, strategy Strategy) {
+	if result.TypeChecked {
+		r.TypeCheckFailures++
+	}
+	if result.FailingInputPath != "" {
+		r.FailingInputs = append(r.FailingInputs, result.FailingInputPath)
+	}
+	if result.Benchmark != nil {
+		r.Benchmark = result.Benchmark
+	}
+	// a rejected test didn't run, the properties of the previous run are still the latest known
+	if strategy.Name() == StrategyProperty && result.Rejection == "" {
+		r.Properties = nil
+		for _, name := range result.PassedSubtests {
+			r.Properties = append(r.Properties, PropertyResult{Name: name, Held: true})
+		}
+		for _, name := range result.FailedSubtests {
+			r.Properties = append(r.Properties, PropertyResult{Name: name, Counterexample: result.Counterexamples[name]})
+		}
+	}
+}
+
+func (r *Report) Print(w io.Writer) {
+	fmt.Fprintln(w, "Report:")
+	fmt.Fprintf(w, "  passed: %t\n", r.Passed)
+	if r.Tests > 1 {
+		fmt.Fprintf(w, "  passed tests: %d of %d\n", r.PassedTests, r.Tests)
+	}
+	fmt.Fprintf(w, "  generations: %d\n", r.Generations)
+	fmt.Fprintf(w, "  cache hits: %d\n", r.CacheHits)
+	fmt.Fprintf(w, "  compile errors found before go test: %d\n", r.TypeCheckFailures)
+	fmt.Fprintf(w, "  repair rounds saved by local fixes: %d\n", r.SavedRounds)
+	if r.Benchmark != nil {
+		fmt.Fprintf(w, "  benchmark: %.2f ns/op, %d B/op, %d allocs/op\n", r.Benchmark.NsPerOp, r.Benchmark.BytesPerOp, r.Benchmark.AllocsPerOp)
+	}
+	for _, property := range r.Properties {
+		switch {
+		case property.Held:
+			fmt.Fprintf(w, "  property held: %s\n", property.Name)
+		case property.Counterexample != "":
+			fmt.Fprintf(w, "  property failed: %s, counterexample %s\n", property.Name, property.Counterexample)
+		default:
+			fmt.Fprintf(w, "  property failed: %s\n", property.Name)
+		}
+	}
+	names := make([]string, 0, len(r.Renamed))
+	for name := range r.Renamed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  renamed not to replace a hand-written test: %s to %s\n", name, r.Renamed[name])
+	}
+	for _, path := range r.SupportFiles {
+		fmt.Fprintf(w, "  support file the tests need, keep it with them: %s\n", path)
+	}
+	for _, path := range r.FailingInputs {
+		fmt.Fprintf(w, "  fuzzer failing input: %s\n", path)
+	}
+}
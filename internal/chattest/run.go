@@ -2,40 +2,114 @@ package chattest
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"go/token"
 	"io"
+	"slices"
 
 	"pleto.dev/chattest/internal/integrations/llm"
 )
 
 func Run(ctx context.Context, cfg *Config, llm llm.LLM, w io.Writer) error {
+	compaction, err := NewCompactionPolicy(cfg.History, cfg.HistoryRounds)
+	if err != nil {
+		return fmt.Errorf("NewCompactionPolicy(): %w", err)
+	}
+
+	strategy, err := NewStrategy(cfg.Strategy)
+	if err != nil {
+		return fmt.Errorf("NewStrategy(): %w", err)
+	}
+
+	kind, err := ParseKind(cfg.Kind)
+	if err != nil {
+		return fmt.Errorf("ParseKind(): %w", err)
+	}
+	if kind != KindTest && strategy.Name() != StrategySingle {
+		return fmt.Errorf("strategy %s only applies to the %s kind", strategy.Name(), KindTest)
+	}
+	// a suite is a test with a subtest per member, which none of the other shapes is
+	if cfg.TypeName != "" && (kind != KindTest || strategy.Name() != StrategySingle) {
+		return fmt.Errorf("-type only applies to the %s kind with the %s strategy", KindTest, StrategySingle)
+	}
+	if cfg.TestsPerFunc < 1 {
+		return fmt.Errorf("-tests-per-func must be at least 1, got %d", cfg.TestsPerFunc)
+	}
+	if cfg.TestsPerFunc > 1 && (kind != KindTest || strategy.Name() != StrategySingle || cfg.TypeName != "") {
+		return fmt.Errorf("-tests-per-func only applies to a function, with the %s kind and the %s strategy", KindTest, StrategySingle)
+	}
+
+	prompts, err := loadPrompts(cfg)
+	if err != nil {
+		return fmt.Errorf("loadPrompts(): %w", err)
+	}
+
 	project, err := LoadPackages(cfg)
 	if err != nil {
 		return fmt.Errorf("LoadPackages(): %w", err)
 	}
 
-	llmContext := NewLLMTestContext()
-	llmContext.AddTestPrompt(project)
-	llmTestGenerator := NewLLMTestGenerator(llm)
+	if kind == KindExample && !token.IsExported(project.FocalMethod.Name) {
+		return fmt.Errorf("examples are only generated for exported functions, %s is not exported", project.FocalMethod.Name)
+	}
+
+	llmContext := NewLLMTestContext(compaction, prompts, strategy, kind, cfg.TestsPerFunc)
+	if err := llmContext.AddTestPrompt(project); err != nil {
+		return fmt.Errorf("AddTestPrompt(): %w", err)
+	}
+
+	progress := newProgress(w, cfg.Quiet)
+	llmTestGenerator := NewLLMTestGenerator(llm, cfg.Model, progress.update)
+
+	if cfg.DryRun || cfg.DryRunJSON {
+		return printDryRun(w, llmTestGenerator, llmContext, cfg.DryRunJSON)
+	}
+
+	report := &Report{}
+	defer report.Print(w)
 
+	tests := NewGeneratedTests(kind.testLocation(project.FocalMethod))
+	var results []*TestRunResult
 	for i := 0; true; i++ {
-		llmTest, err := llmTestGenerator.Generate(ctx, llmContext)
+		llmTest, err := generate(ctx, llmTestGenerator, llmContext, progress, w)
 		if err != nil {
-			return fmt.Errorf("llmTestGenerator.Generate(): %w", err)
+			return fmt.Errorf("generate(): %w", err)
 		}
+		report.addGeneration(llmTest)
 
-		test := NewTest(llmTest, project.FocalMethod.InferTestLocation(), cfg.RepoPath)
-
-		if err := test.Save(); err != nil {
-			return fmt.Errorf("Save(): %w", err)
+		previous := results
+		results, err = check(llmTest, project, cfg, llmContext, tests, previous)
+		if err != nil {
+			return fmt.Errorf("check(): %w", err)
 		}
+		report.addResults(results, tests, llmContext.Strategy)
 
-		result, err := test.Run()
-		if err != nil {
-			return fmt.Errorf("Run(): %w", err)
+		// the mistakes that can be fixed mechanically don't need a repair round
+		var fixes []string
+		for fix := 0; fix < maxLocalFixes && hasCompileError(results); fix++ {
+			fixed, applied, err := fixLocally(llmTest, results)
+			if err != nil {
+				return fmt.Errorf("fixLocally(): %w", err)
+			}
+			if len(applied) == 0 {
+				break
+			}
+			fixes = append(fixes, applied...)
+
+			llmTest = fixed
+			results, err = check(llmTest, project, cfg, llmContext, tests, previous)
+			if err != nil {
+				return fmt.Errorf("check(): %w", err)
+			}
+			report.addResults(results, tests, llmContext.Strategy)
+		}
+		if len(fixes) > 0 && allPassed(results) {
+			report.SavedRounds++
 		}
 
-		if !result.TestFailed {
+		if allPassed(results) {
+			report.Passed = true
 			fmt.Fprintln(w, "Test passed")
 			break
 		}
@@ -44,9 +118,224 @@ func Run(ctx context.Context, cfg *Config, llm llm.LLM, w io.Writer) error {
 			break
 		}
 
-		llmContext.AddRepairPrompt(llmTest, result)
+		if err := llmContext.AddRepairPrompt(llmTest, results, tests.PassedNames(), fixes); err != nil {
+			return fmt.Errorf("AddRepairPrompt(): %w", err)
+		}
 		fmt.Fprintln(w, "Test failed, trying to repair it")
 	}
 
 	return nil
 }
+
+// check validates the generated tests, then saves them in place of the failing ones and runs each of them.
+// previous are the results of the previous attempt, or nil for the first one.
+func check(llmTest *LLMGeneratedTest, project *Project, cfg *Config, llmContext *LLMTestContext, tests *GeneratedTests, previous []*TestRunResult) ([]*TestRunResult, error) {
+	var err error
+	if llmTest.Tests, err = tests.avoidCollisions(llmTest.Tests); err != nil {
+		return nil, fmt.Errorf("avoidCollisions(): %w", err)
+	}
+
+	// the tests that passed are kept as they are, even when the LLM writes them again
+	passed := tests.PassedNames()
+	llmTest.Tests = slices.DeleteFunc(llmTest.Tests, func(test TestFunc) bool {
+		return slices.Contains(passed, test.Name)
+	})
+	if len(llmTest.Tests) == 0 {
+		return []*TestRunResult{{
+			TestFailed: true,
+			Rejection:  "the answer only has tests that already passed, instead of the failing ones",
+		}}, nil
+	}
+
+	rejections, err := validate(llmTest, project, llmContext, previous)
+	if err != nil {
+		return nil, fmt.Errorf("validate(): %w", err)
+	}
+	if len(rejections) > 0 {
+		return rejections, nil
+	}
+
+	if preparer, ok := llmContext.Strategy.(preparer); ok {
+		paths, err := preparer.prepare(tests.Location)
+		if err != nil {
+			return nil, fmt.Errorf("prepare(): %w", err)
+		}
+		for _, path := range paths {
+			if !slices.Contains(tests.SupportFiles, path) {
+				tests.SupportFiles = append(tests.SupportFiles, path)
+			}
+		}
+	}
+
+	content, err := tests.render(llmTest)
+	if err != nil {
+		return nil, fmt.Errorf("render(): %w", err)
+	}
+
+	disallowed, err := disallowedImports(project.Module, tests.Location, content)
+	if err != nil {
+		return nil, fmt.Errorf("disallowedImports(): %w", err)
+	}
+	if len(disallowed) > 0 {
+		return []*TestRunResult{{
+			TestFailed:        true,
+			DisallowedImports: disallowed,
+			AllowedModules:    append([]string{project.Module.Path}, project.Module.Requires...),
+		}}, nil
+	}
+
+	compileError, err := typeCheck(project, tests.Location, content)
+	if err != nil {
+		return nil, fmt.Errorf("typeCheck(): %w", err)
+	}
+	if compileError != "" {
+		return []*TestRunResult{{
+			TestFailed:   true,
+			CompileError: compileError,
+			TypeChecked:  true,
+			Suggestions:  suggestDefinitions(project, tests.Location, compileError),
+		}}, nil
+	}
+
+	if err := tests.write(llmTest, content); err != nil {
+		return nil, fmt.Errorf("write(): %w", err)
+	}
+
+	var results []*TestRunResult
+	for _, testFunc := range llmTest.Tests {
+		result, err := NewTest(testFunc, tests.Location, cfg, llmContext.Kind).Run()
+		if err != nil {
+			return nil, fmt.Errorf("Run(): %w", err)
+		}
+		// the package doesn't compile, so none of the tests does
+		if result.CompileError != "" {
+			result.Suggestions = suggestDefinitions(project, tests.Location, result.CompileError)
+			return []*TestRunResult{result}, nil
+		}
+		results = append(results, result)
+	}
+	tests.record(results)
+
+	return results, nil
+}
+
+// validate checks the kind, the shape and the quality of the generated tests.
+// It returns their rejections, or none when they can run.
+func validate(llmTest *LLMGeneratedTest, project *Project, llmContext *LLMTestContext, previous []*TestRunResult) ([]*TestRunResult, error) {
+	var rejections []*TestRunResult
+	for _, test := range llmTest.Tests {
+		previousResult := resultOf(previous, test.Name)
+
+		rejection := llmContext.Kind.validate(test)
+		if rejection == "" {
+			var err error
+			rejection, err = llmContext.Strategy.Validate(test, previousResult)
+			if err != nil {
+				return nil, fmt.Errorf("Strategy.Validate(): %w", err)
+			}
+		}
+		if rejection == "" {
+			var err error
+			rejection, err = lintTest(test, llmContext.Kind, lintedFocal(project.FocalMethod, llmContext.Strategy))
+			if err != nil {
+				return nil, fmt.Errorf("lintTest(): %w", err)
+			}
+		}
+		if rejection == "" {
+			continue
+		}
+
+		result := &TestRunResult{
+			Name:       test.Name,
+			TestFailed: true,
+			Rejection:  rejection,
+		}
+		// the test wasn't run, so the cases that passed before are still the ones to keep
+		if previousResult != nil {
+			result.PassedSubtests = previousResult.PassedSubtests
+		}
+		rejections = append(rejections, result)
+	}
+	if len(rejections) > 0 {
+		return rejections, nil
+	}
+
+	rejection, err := validateSuite(llmTest, project.FocalMethod)
+	if err != nil {
+		return nil, fmt.Errorf("validateSuite(): %w", err)
+	}
+	if rejection != "" {
+		return []*TestRunResult{{TestFailed: true, Rejection: rejection}}, nil
+	}
+	return nil, nil
+}
+
+// lintedFocal returns the function under test whose calls can't compute the expected values,
+// or nil when they can: the properties of a function compare its calls, and the members of a type use each other.
+func lintedFocal(focal *FocalMethod, strategy Strategy) *focalFunc {
+	if len(focal.Members) > 0 || strategy.Name() == StrategyProperty {
+		return nil
+	}
+	return &focalFunc{name: focal.Name, pkg: focal.Pkg.Name, method: focal.Recv != ""}
+}
+
+// resultOf returns the result of the named test, or nil if it has none.
+func resultOf(results []*TestRunResult, name string) *TestRunResult {
+	for _, result := range results {
+		if result.Name == name {
+			return result
+		}
+	}
+	return nil
+}
+
+func allPassed(results []*TestRunResult) bool {
+	for _, result := range results {
+		if result.TestFailed {
+			return false
+		}
+	}
+	return true
+}
+
+func hasCompileError(results []*TestRunResult) bool {
+	return slices.ContainsFunc(results, func(result *TestRunResult) bool { return result.CompileError != "" })
+}
+
+// maxRegenerations caps how many times the same context is sent again
+// after the LLM answered with nothing usable.
+const maxRegenerations = 2
+
+// generate asks the LLM for a test, recovering from the failures that a different request can fix.
+func generate(ctx context.Context, generator *LLMTestGenerator, llmContext *LLMTestContext, progress *progress, w io.Writer) (*LLMGeneratedTest, error) {
+	regenerations := 0
+	for {
+		llmTest, err := generator.Generate(ctx, llmContext)
+		progress.done()
+		switch {
+		case err == nil:
+			return llmTest, nil
+		case errors.Is(err, llm.ErrAuthFailed):
+			return nil, fmt.Errorf("the LLM provider rejected the request, check the API key and the account: %w", err)
+		case errors.Is(err, llm.ErrRateLimited):
+			return nil, fmt.Errorf("the LLM provider is still rate limiting after retries, lower -rpm or -tpm: %w", err)
+		case errors.Is(err, llm.ErrContextLengthExceeded):
+			shrunk, shrinkErr := llmContext.Shrink()
+			if shrinkErr != nil {
+				return nil, fmt.Errorf("Shrink(): %w", shrinkErr)
+			}
+			if !shrunk {
+				return nil, fmt.Errorf("the prompt doesn't fit the model's context even without examples and definitions: %w", err)
+			}
+			fmt.Fprintln(w, "Prompt too long, retrying with a shorter one")
+		case errors.Is(err, llm.ErrContentFiltered), errors.Is(err, llm.ErrEmptyResponse):
+			if regenerations >= maxRegenerations {
+				return nil, fmt.Errorf("llmTestGenerator.Generate(): %w", err)
+			}
+			regenerations++
+			fmt.Fprintf(w, "No usable answer (%s), asking again\n", err)
+		default:
+			return nil, fmt.Errorf("llmTestGenerator.Generate(): %w", err)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package chattest
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+const (
+	StrategySingle   = "single"
+	StrategyTable    = "table"
+	StrategyProperty = "property"
+)
+
+// Strategy decides the shape of the test the LLM is asked for,
+// and checks that a generated test has that shape before it is run.
+type Strategy interface {
+	Name() string
+	// Validate returns why the test doesn't have the expected shape, or "" if it does.
+	// previous is the result of the previous attempt, or nil for the first one.
+	Validate(test TestFunc, previous *TestRunResult) (string, error)
+}
+
+// preparer is a Strategy whose tests need more than the generated test, i.e. a helper they call.
+type preparer interface {
+	// prepare is called before the test is saved at location, it returns the files it wrote.
+	prepare(location *TestLocation) ([]OsPath, error)
+}
+
+func NewStrategy(name string) (Strategy, error) {
+	switch name {
+	case StrategySingle:
+		return singleStrategy{}, nil
+	case StrategyTable:
+		return tableStrategy{}, nil
+	case StrategyProperty:
+		return propertyStrategy{}, nil
+	}
+	return nil, fmt.Errorf("unknown strategy %q, expected %q, %q or %q", name, StrategySingle, StrategyTable, StrategyProperty)
+}
+
+// singleStrategy asks for one plain test, any shape goes.
+type singleStrategy struct{}
+
+func (singleStrategy) Name() string {
+	return StrategySingle
+}
+
+func (singleStrategy) Validate(TestFunc, *TestRunResult) (string, error) {
+	return "", nil
+}
+
+// tableStrategy asks for a single table-driven test: a []struct{...} table of cases run as t.Run subtests.
+// When some cases failed, the repaired test must keep the cases that passed.
+type tableStrategy struct{}
+
+func (tableStrategy) Name() string {
+	return StrategyTable
+}
+
+func (tableStrategy) Validate(test TestFunc, previous *TestRunResult) (string, error) {
+	testFunc, err := parseAST(test.Source, KindTest)
+	if err != nil {
+		return "", fmt.Errorf("parseAST(): %w", err)
+	}
+
+	shape := inspectTableShape(testFunc)
+	var problems []string
+	if !shape.hasTable {
+		problems = append(problems, "the test has no []struct{...} table of cases")
+	}
+	if !shape.hasSubtests {
+		problems = append(problems, "the test doesn't range over the cases calling t.Run for each of them")
+	}
+
+	if previous != nil {
+		if dropped := droppedCases(previous.PassedSubtests, shape.caseNames); len(dropped) > 0 {
+			problems = append(problems, "the test dropped the cases that passed before: "+strings.Join(dropped, ", "))
+		}
+	}
+
+	return strings.Join(problems, "\n"), nil
+}
+
+// propertyStrategy asks for properties of the function, such as round trips or invariants, instead of examples.
+// Each property is a t.Run subtest checked on random inputs by chattestCheckProperty, which shrinks the counterexamples.
+type propertyStrategy struct{}
+
+func (propertyStrategy) Name() string {
+	return StrategyProperty
+}
+
+func (propertyStrategy) Validate(test TestFunc, previous *TestRunResult) (string, error) {
+	testFunc, err := parseAST(test.Source, KindTest)
+	if err != nil {
+		return "", fmt.Errorf("parseAST(): %w", err)
+	}
+
+	shape := inspectPropertyShape(testFunc)
+	var problems []string
+	if shape.subtests == 0 {
+		problems = append(problems, "the test doesn't check each property in its own t.Run subtest")
+	}
+	if shape.checks == 0 {
+		problems = append(problems, "the test doesn't check any property with chattestCheckProperty or quick.Check")
+	}
+
+	if previous != nil {
+		if dropped := droppedCases(previous.PassedSubtests, shape.caseNames); len(dropped) > 0 {
+			problems = append(problems, "the test dropped the properties that held before: "+strings.Join(dropped, ", "))
+		}
+	}
+
+	return strings.Join(problems, "\n"), nil
+}
+
+func (propertyStrategy) prepare(location *TestLocation) ([]OsPath, error) {
+	path, err := writeSupportFile(location, propertyCheckFile, propertyCheckSource)
+	if err != nil {
+		return nil, fmt.Errorf("writeSupportFile(): %w", err)
+	}
+	return []OsPath{path}, nil
+}
+
+type propertyShape struct {
+	subtests int
+	checks   int
+	// caseNames are the string literals of the test, the property names are among them
+	caseNames map[string]bool
+}
+
+func inspectPropertyShape(testFunc *ast.FuncDecl) propertyShape {
+	shape := propertyShape{caseNames: make(map[string]bool)}
+
+	ast.Inspect(testFunc.Body, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.CallExpr:
+			if isTRunCall(node) {
+				shape.subtests++
+			}
+			if isPropertyCheckCall(node) {
+				shape.checks++
+			}
+		case *ast.BasicLit:
+			if node.Kind == token.STRING {
+				if name, err := strconv.Unquote(node.Value); err == nil {
+					shape.caseNames[subtestName(name)] = true
+				}
+			}
+		}
+		return true
+	})
+
+	return shape
+}
+
+func isPropertyCheckCall(call *ast.CallExpr) bool {
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		return fun.Name == "chattestCheckProperty"
+	case *ast.SelectorExpr:
+		pkg, ok := fun.X.(*ast.Ident)
+		return ok && pkg.Name == "quick" && (fun.Sel.Name == "Check" || fun.Sel.Name == "CheckEqual")
+	}
+	return false
+}
+
+type tableShape struct {
+	hasTable    bool
+	hasSubtests bool
+	// caseNames are the string literals of the test, the case names are among them
+	caseNames map[string]bool
+}
+
+func inspectTableShape(testFunc *ast.FuncDecl) tableShape {
+	shape := tableShape{caseNames: make(map[string]bool)}
+
+	ast.Inspect(testFunc.Body, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.CompositeLit:
+			if array, ok := node.Type.(*ast.ArrayType); ok && array.Len == nil {
+				if _, ok := array.Elt.(*ast.StructType); ok {
+					shape.hasTable = true
+				}
+			}
+		case *ast.RangeStmt:
+			ast.Inspect(node.Body, func(n ast.Node) bool {
+				if isTRunCall(n) {
+					shape.hasSubtests = true
+				}
+				return true
+			})
+		case *ast.BasicLit:
+			if node.Kind == token.STRING {
+				if name, err := strconv.Unquote(node.Value); err == nil {
+					shape.caseNames[subtestName(name)] = true
+				}
+			}
+		}
+		return true
+	})
+
+	return shape
+}
+
+func isTRunCall(n ast.Node) bool {
+	call, ok := n.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	selector, ok := call.Fun.(*ast.SelectorExpr)
+	return ok && selector.Sel.Name == "Run"
+}
+
+// subtestName rewrites a case name the way go test reports it, i.e. "empty input" as "empty_input".
+func subtestName(name string) string {
+	return strings.ReplaceAll(name, " ", "_")
+}
+
+// droppedCases returns the passed subtests, reported as "TestX/name", whose name isn't in caseNames anymore.
+func droppedCases(passedSubtests []string, caseNames map[string]bool) []string {
+	var dropped []string
+	for _, subtest := range passedSubtests {
+		_, name, found := strings.Cut(subtest, "/")
+		if found && !caseNames[name] {
+			dropped = append(dropped, name)
+		}
+	}
+	return dropped
+}
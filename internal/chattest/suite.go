@@ -0,0 +1,40 @@
+package chattest
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// validateSuite returns why the suite generated for a focal type isn't one, or "" if it is.
+// A suite must exercise every constructor and method of the type, on its own or in a lifecycle.
+func validateSuite(llmTest *LLMGeneratedTest, fm *FocalMethod) (string, error) {
+	if len(fm.Members) == 0 {
+		return "", nil
+	}
+
+	used := make(map[string]bool)
+	for _, test := range llmTest.Tests {
+		testFunc, err := parseAST(test.Source, KindTest)
+		if err != nil {
+			return "", fmt.Errorf("parseAST(): %w", err)
+		}
+		ast.Inspect(testFunc.Body, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Ident); ok {
+				used[ident.Name] = true
+			}
+			return true
+		})
+	}
+
+	var missing []string
+	for _, member := range fm.Members {
+		if !used[member] {
+			missing = append(missing, member)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Sprintf("the suite doesn't use these members of %s: %s", fm.Name, strings.Join(missing, ", ")), nil
+	}
+	return "", nil
+}
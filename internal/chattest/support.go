@@ -0,0 +1,29 @@
+package chattest
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// propertyCheckSource defines chattestCheckProperty, which the tests of the property strategy call.
+// It has neither a package clause nor a generated code header, they are added when it is written.
+//
+//go:embed support/property_check.go.txt
+var propertyCheckSource string
+
+const propertyCheckFile = "chattest_property_test.go"
+
+// writeSupportFile writes a helper the generated tests depend on next to the test, in the test's package.
+// It is overwritten on every run, so it always matches the version of chattest that generated the test,
+// and left in place afterwards, since the saved tests need it. It returns the path of the file.
+func writeSupportFile(location *TestLocation, name string, source string) (OsPath, error) {
+	path := filepath.Join(filepath.Dir(location.Path), name)
+	// the header must come before the package clause for tools to recognize the file as generated
+	content := fmt.Sprintf("// Code generated by chattest. DO NOT EDIT.\n\npackage %s\n\n%s", location.Pkg.Name, source)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		return "", fmt.Errorf("os.WriteFile(): %w", err)
+	}
+	return path, nil
+}
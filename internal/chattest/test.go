@@ -1,22 +1,43 @@
 package chattest
 
+import (
+	"strings"
+	"time"
+)
+
 type Pkg struct {
 	ID   PackageID
 	Name string
 }
 
+// ImportPath is the path of the package without the test variant suffix of its ID,
+// i.e. "a/b" for the ID "a/b [a/b.test]".
+func (p Pkg) ImportPath() string {
+	path, _, _ := strings.Cut(string(p.ID), " ")
+	return path
+}
+
+// Test is a generated test function, run on its own.
 type Test struct {
-	*LLMGeneratedTest
+	TestFunc
 	RepoPath string
 	Package  Pkg
 	Path     OsPath
+	Kind     Kind
+	// FuzzTime bounds the fuzzing of a fuzz test.
+	FuzzTime time.Duration
+	// BenchTime is the -benchtime of a benchmark, i.e. "1s" or "100x".
+	BenchTime string
 }
 
-func NewTest(llmGenTest *LLMGeneratedTest, details *TestLocation, repoPath string) *Test {
+func NewTest(testFunc TestFunc, details *TestLocation, cfg *Config, kind Kind) *Test {
 	return &Test{
-		LLMGeneratedTest: llmGenTest,
-		RepoPath:         repoPath,
-		Package:          details.Pkg,
-		Path:             details.Path,
+		TestFunc:  testFunc,
+		RepoPath:  cfg.RepoPath,
+		Package:   details.Pkg,
+		Path:      details.Path,
+		Kind:      kind,
+		FuzzTime:  cfg.FuzzTime,
+		BenchTime: cfg.BenchTime,
 	}
 }
@@ -0,0 +1,119 @@
+package chattest
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// generatedMarker is the doc comment line of the tests and helpers written by chattest, which it can replace,
+// unlike the hand-written ones.
+const generatedMarker = "//chattest:generated"
+
+// avoidCollisions renames the tests named like a hand-written function of the test package,
+// i.e. TestParse to TestParse_generated2, so saving them doesn't replace or redeclare it.
+// A test is renamed the same way on every attempt, and never like a test that already passed.
+// The tests whose new name already passed are dropped, like the tests that passed are.
+func (g *GeneratedTests) avoidCollisions(tests []TestFunc) ([]TestFunc, error) {
+	handWritten, err := handWrittenFuncs(g.Location)
+	if err != nil {
+		return nil, fmt.Errorf("handWrittenFuncs(): %w", err)
+	}
+	passed := g.PassedNames()
+
+	taken := make(map[string]bool)
+	for name := range handWritten {
+		taken[name] = true
+	}
+	for _, test := range append(slices.Clone(g.Passed), tests...) {
+		taken[test.Name] = true
+	}
+
+	var renamed []TestFunc
+	for _, test := range tests {
+		if !handWritten[test.Name] {
+			renamed = append(renamed, test)
+			continue
+		}
+
+		name, found := g.Renamed[test.Name]
+		if found && slices.Contains(passed, name) {
+			continue
+		}
+		for i := 2; !found || taken[name]; i++ {
+			name, found = fmt.Sprintf("%s_generated%d", test.Name, i), true
+		}
+		taken[name] = true
+		g.Renamed[test.Name] = name
+
+		source, err := renameFunc(test.Source, test.Name, name)
+		if err != nil {
+			return nil, fmt.Errorf("renameFunc(): %w", err)
+		}
+		renamed = append(renamed, TestFunc{Name: name, Source: source})
+	}
+	return renamed, nil
+}
+
+// handWrittenFuncs returns the names of the functions chattest didn't write in the test files of the package at location,
+// as they are on disk, the test file included.
+func handWrittenFuncs(location *TestLocation) (map[string]bool, error) {
+	paths, err := filepath.Glob(filepath.Join(filepath.Dir(location.Path), "*_test.go"))
+	if err != nil {
+		return nil, fmt.Errorf("filepath.Glob(): %w", err)
+	}
+
+	names := make(map[string]bool)
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("os.ReadFile(): %w", err)
+		}
+		// the test file is written by chattest, it must parse, the other files may be broken or of another package
+		file, err := parser.ParseFile(token.NewFileSet(), path, src, parser.ParseComments)
+		if err != nil && path == location.Path {
+			return nil, fmt.Errorf("parser.ParseFile(): %w", err)
+		}
+		if err != nil || file.Name.Name != location.Pkg.Name {
+			continue
+		}
+
+		for _, decl := range file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && !isGenerated(fn) {
+				names[fn.Name.Name] = true
+			}
+		}
+	}
+	return names, nil
+}
+
+func isGenerated(decl ast.Decl) bool {
+	doc := declDoc(decl)
+	return doc != nil && slices.ContainsFunc(doc.List, func(comment *ast.Comment) bool {
+		return comment.Text == generatedMarker
+	})
+}
+
+// renameFunc renames the function declared by the source.
+func renameFunc(source, from, to string) (string, error) {
+	src := decorateWithPackage(source)
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return "", fmt.Errorf("parser.ParseFile(): %w", err)
+	}
+
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == from {
+			start := fset.Position(fn.Name.Pos()).Offset
+			end := fset.Position(fn.Name.End()).Offset
+			src = src[:start] + to + src[end:]
+			break
+		}
+	}
+	return src[len(decorateWithPackage("")):], nil
+}
@@ -4,9 +4,11 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -22,6 +24,18 @@ func ExtractTestFailure(goTestResult string) (bool, string) {
 		if len(errorMatch) > 1 {
 			return true, strings.TrimSpace(errorMatch[1])
 		}
+
+		// a failed example reports what it printed and what its output comment expected
+		examplePattern := regexp.MustCompile(`(?s)(got:\n.*?\nwant:\n.*?)\n(?:FAIL|---|ok\s)`)
+		if exampleMatch := examplePattern.FindStringSubmatch(goTestResult); len(exampleMatch) > 1 {
+			return true, strings.TrimSpace(exampleMatch[1])
+		}
+
+		// without testify, the message is the one logged with t.Error and the like
+		logPattern := regexp.MustCompile(`(?m)^\s+\S+_test\.go:[0-9]+: (.*)$`)
+		if logMatch := logPattern.FindStringSubmatch(goTestResult); len(logMatch) > 1 {
+			return true, strings.TrimSpace(logMatch[1])
+		}
 		return true, "Error message not found"
 	}
 
@@ -48,14 +62,109 @@ func ExtractCompileErrors(stderr bytes.Buffer) (string, error) {
 	return compileErrors.String(), nil
 }
 
+// ExtractSubtests returns the names of the subtests, as "TestX/name", that passed and failed.
+func ExtractSubtests(goTestResult string) (passed []string, failed []string) {
+	subtestPattern := regexp.MustCompile(`(?m)^\s+--- (PASS|FAIL): (\S+/\S+)`)
+
+	for _, match := range subtestPattern.FindAllStringSubmatch(goTestResult, -1) {
+		if match[1] == "PASS" {
+			passed = append(passed, match[2])
+		} else {
+			failed = append(failed, match[2])
+		}
+	}
+
+	return passed, failed
+}
+
+// ExtractCounterexamples returns the shrunk counterexamples reported by chattestCheckProperty, by subtest.
+func ExtractCounterexamples(goTestResult string) map[string]string {
+	counterexamplePattern := regexp.MustCompile(`(?m)counterexample for (\S+): (.*)$`)
+
+	counterexamples := make(map[string]string)
+	for _, match := range counterexamplePattern.FindAllStringSubmatch(goTestResult, -1) {
+		counterexamples[match[1]] = strings.TrimSpace(match[2])
+	}
+	return counterexamples
+}
+
+// ExtractFailingInput returns the path of the failing input the fuzzer saved, relative to the package directory.
+func ExtractFailingInput(goTestResult string) (string, bool) {
+	failingInputPattern := regexp.MustCompile(`Failing input written to (\S+)`)
+
+	match := failingInputPattern.FindStringSubmatch(goTestResult)
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+type BenchmarkResult struct {
+	NsPerOp     float64
+	BytesPerOp  int64
+	AllocsPerOp int64
+}
+
+// ExtractBenchmark returns the result of the named benchmark from the output of go test -bench -benchmem.
+func ExtractBenchmark(goTestResult string, name string) (*BenchmarkResult, bool) {
+	// i.e. "BenchmarkDiv-8   	1000000	      1.2 ns/op	       0 B/op	       0 allocs/op"
+	benchPattern := regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(name) + `(?:-[0-9]+)?\s+[0-9]+\s+([0-9.]+) ns/op(?:\s+([0-9]+) B/op\s+([0-9]+) allocs/op)?`)
+
+	match := benchPattern.FindStringSubmatch(goTestResult)
+	if match == nil {
+		return nil, false
+	}
+
+	result := &BenchmarkResult{}
+	result.NsPerOp, _ = strconv.ParseFloat(match[1], 64)
+	result.BytesPerOp, _ = strconv.ParseInt(match[2], 10, 64)
+	result.AllocsPerOp, _ = strconv.ParseInt(match[3], 10, 64)
+	return result, true
+}
+
 type TestRunResult struct {
+	// Name is the test that ran, or "" when the result is about all the tests of the generation,
+	// i.e. they were rejected or don't compile.
+	Name          string
 	TestFailed    bool
 	FailedMessage string
 	CompileError  string
+	// TypeChecked is set when the CompileError was found by type-checking the test in memory,
+	// without writing it and running go test.
+	TypeChecked bool
+	// Suggestions are the real symbols closest to the undefined names of the CompileError.
+	Suggestions []Suggestion
+	// Rejection is why the test was rejected without running it, i.e. it doesn't have the shape the strategy asks for.
+	Rejection string
+	// DisallowedImports are the imports of packages the module doesn't depend on, the test isn't run with them.
+	DisallowedImports []string
+	// AllowedModules are the modules the test can import the packages of, besides the standard library.
+	AllowedModules []string
+	PassedSubtests []string
+	FailedSubtests []string
+	// Counterexamples are the shrunk inputs that broke the properties of a property test, by subtest.
+	Counterexamples map[string]string
+	// FailingInputPath is where the fuzzer saved the input that made the fuzz test fail, under testdata/fuzz.
+	FailingInputPath OsPath
+	FailingInput     string
+	// Benchmark is the measurement of a benchmark that ran successfully.
+	Benchmark *BenchmarkResult
 }
 
 func (t *Test) Run() (*TestRunResult, error) {
-	cmd := exec.Command("go", "test", filepath.Dir(t.Path), "-v", "-run", fmt.Sprintf("^%s$", t.Name))
+	result, err := t.run()
+	if err != nil {
+		return nil, err
+	}
+	// a compile error is the package's, not the test's
+	if result.CompileError == "" {
+		result.Name = t.Name
+	}
+	return result, nil
+}
+
+func (t *Test) run() (*TestRunResult, error) {
+	cmd := exec.Command("go", t.goTestArgs()...)
 	cmd.Dir = t.RepoPath
 
 	var out bytes.Buffer
@@ -79,16 +188,71 @@ func (t *Test) Run() (*TestRunResult, error) {
 
 		testFailed, message := ExtractTestFailure(out.String())
 		if testFailed {
+			passed, failed := ExtractSubtests(out.String())
+			result := &TestRunResult{
+				TestFailed:      true,
+				FailedMessage:   message,
+				PassedSubtests:  passed,
+				FailedSubtests:  failed,
+				Counterexamples: ExtractCounterexamples(out.String()),
+			}
+			if err := t.readFailingInput(out.String(), result); err != nil {
+				return nil, fmt.Errorf("readFailingInput(): %w", err)
+			}
+			return result, nil
+		}
+
+		return nil, fmt.Errorf("cmd.Run(): %w", err)
+	}
+
+	if t.Kind == KindBench {
+		benchmark, found := ExtractBenchmark(out.String(), t.Name)
+		if !found {
 			return &TestRunResult{
 				TestFailed:    true,
-				FailedMessage: message,
+				FailedMessage: fmt.Sprintf("%s didn't report any ns/op, it must call the code under test b.N times", t.Name),
 			}, nil
 		}
-
-		return nil, fmt.Errorf("cmd.Run(): %w", err)
+		return &TestRunResult{
+			TestFailed: false,
+			Benchmark:  benchmark,
+		}, nil
 	}
 
+	passed, _ := ExtractSubtests(out.String())
 	return &TestRunResult{
-		TestFailed: false,
+		TestFailed:     false,
+		PassedSubtests: passed,
 	}, nil
 }
+
+func (t *Test) goTestArgs() []string {
+	funcPattern := fmt.Sprintf("^%s$", t.Name)
+	switch t.Kind {
+	case KindFuzz:
+		return []string{"test", filepath.Dir(t.Path), "-v", "-run", funcPattern, "-fuzz", funcPattern, "-fuzztime", t.FuzzTime.String()}
+	case KindBench:
+		// -run ^$ skips the tests of the package, only the benchmark runs
+		return []string{"test", filepath.Dir(t.Path), "-v", "-run", "^$", "-bench", funcPattern, "-benchtime", t.BenchTime, "-benchmem"}
+	}
+	return []string{"test", filepath.Dir(t.Path), "-v", "-run", funcPattern}
+}
+
+// readFailingInput adds the input the fuzzer found to the result, if it found one.
+// go test keeps it in testdata/fuzz, so it is also replayed as a regression seed by later runs.
+func (t *Test) readFailingInput(goTestResult string, result *TestRunResult) error {
+	relPath, found := ExtractFailingInput(goTestResult)
+	if !found {
+		return nil
+	}
+
+	path := filepath.Join(filepath.Dir(t.Path), relPath)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("os.ReadFile(): %w", err)
+	}
+
+	result.FailingInputPath = path
+	result.FailingInput = string(content)
+	return nil
+}
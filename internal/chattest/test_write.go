@@ -1,197 +1,296 @@
 package chattest
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
-	"io"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
 	"os"
-	"regexp"
+	"slices"
 	"strings"
 
+	"golang.org/x/tools/go/ast/astutil"
 	"golang.org/x/tools/imports"
 )
 
-func (t *Test) Save() error {
-	file, err := cropen(t.Path)
-	if err != nil {
-		return fmt.Errorf("cropen(): %w", err)
-	}
-	defer file.Close()
+// GeneratedTests are the generated tests written to the test file over the rounds of a Run.
+// The tests that passed are kept as they are, the ones that failed are replaced by the next generation,
+// and the helpers are removed once no remaining test needs them.
+// The hand-written tests of the file are never replaced, see avoidCollisions.
+type GeneratedTests struct {
+	Location *TestLocation
+	Passed   []TestFunc
+	Failing  []TestFunc
+	// Helpers are the helpers of the generations written to the file.
+	Helpers []Decl
+	// Renamed are the new names of the generated tests named like a hand-written function, by generated name.
+	Renamed map[string]string
+	// SupportFiles are the files written next to the tests for them to call, which stay once the run is over.
+	SupportFiles []OsPath
+}
 
-	isIn, err := t.isIn(file)
-	if err != nil {
-		return fmt.Errorf("isIn(): %w", err)
-	}
+func NewGeneratedTests(location *TestLocation) *GeneratedTests {
+	return &GeneratedTests{Location: location, Renamed: make(map[string]string)}
+}
 
-	if isIn {
-		err := t.removeFrom(file)
-		if err != nil {
-			return fmt.Errorf("removeFrom(): %w", err)
-		}
+// write saves the content rendered for the generation, in place of the failing tests.
+func (g *GeneratedTests) write(llmTest *LLMGeneratedTest, content []byte) error {
+	if err := os.WriteFile(g.Location.Path, content, 0644); err != nil {
+		return fmt.Errorf("os.WriteFile(): %w", err)
 	}
 
-	if err := t.writeTo(file); err != nil {
-		return fmt.Errorf("writeTo(): %w", err)
+	g.Helpers = append(g.keptHelpers(llmTest), llmTest.Helpers...)
+	g.Failing = llmTest.Tests
+	return nil
+}
+
+// render returns the content the test file has once the generation is saved, without saving it.
+func (g *GeneratedTests) render(llmTest *LLMGeneratedTest) ([]byte, error) {
+	src, err := os.ReadFile(g.Location.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("os.ReadFile(): %w", err)
 	}
 
-	if err := fixImports(file); err != nil {
-		return fmt.Errorf("fixImports(): %w", err)
+	// the helpers written by an earlier run aren't tracked, the ones declared again replace them all the same
+	var redeclared []string
+	for _, helper := range llmTest.Helpers {
+		redeclared = append(redeclared, helper.Names...)
+	}
+	src, err = removeDecls(src, g.replacedNames(llmTest, g.keptHelpers(llmTest)), redeclared)
+	if err != nil {
+		return nil, fmt.Errorf("removeDecls(): %w", err)
 	}
 
-	return nil
-}
+	src = g.appendTo(src, llmTest)
 
-// cropen creates a file if it does not exist, or opens an existing file in append mode.
-func cropen(path string) (*os.File, error) {
-	if !fileExists(path) {
-		file, err := os.Create(path)
-		if err != nil {
-			return nil, fmt.Errorf("os.Create(): %w", err)
+	for _, imp := range llmTest.Imports {
+		if src, err = addImport(src, imp.Name, imp.Path); err != nil {
+			return nil, fmt.Errorf("addImport(): %w", err)
 		}
-		return file, nil
-	}
-	file, err := os.OpenFile(path, os.O_APPEND|os.O_RDWR, os.ModeAppend)
-	if err != nil {
-		return nil, fmt.Errorf("os.OpenFile(): %w", err)
 	}
-	return file, nil
-}
 
-func (t *Test) isIn(file *os.File) (bool, error) {
-	if _, err := file.Seek(0, io.SeekStart); err != nil {
-		return false, fmt.Errorf("file.Seek(0, io.SeekStart): %w", err)
+	// goimports only resolves the packages of the module it runs in,
+	// so an external test package gets the import of the package under test explicitly
+	if strings.HasSuffix(g.Location.Pkg.Name, "_test") {
+		if src, err = addImport(src, "", g.Location.Pkg.ImportPath()); err != nil {
+			return nil, fmt.Errorf("addImport(): %w", err)
+		}
 	}
 
-	if contains, err := t.scanLinesForTestFunc(file); err != nil {
-		return false, fmt.Errorf("scanLinesForTestFunc(): %w", err)
-	} else if contains {
-		return true, nil
+	src, err = imports.Process(g.Location.Path, src, nil)
+	if err != nil {
+		return nil, fmt.Errorf("imports.Process(): %w", err)
 	}
-	return false, nil
+
+	return src, nil
 }
 
-func (t *Test) scanLinesForTestFunc(file *os.File) (bool, error) {
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		matches := t.matchesTestFunc(scanner.Text())
-		if matches {
-			return true, nil
+// record moves the failing tests that passed their run to the kept ones.
+func (g *GeneratedTests) record(results []*TestRunResult) {
+	passed := make(map[string]bool)
+	for _, result := range results {
+		if !result.TestFailed {
+			passed[result.Name] = true
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		return false, err
+	var failing []TestFunc
+	for _, test := range g.Failing {
+		if passed[test.Name] {
+			g.Passed = append(g.Passed, test)
+		} else {
+			failing = append(failing, test)
+		}
 	}
-
-	return false, nil
+	g.Failing = failing
 }
 
-func (t *Test) matchesTestFunc(line string) bool {
-	pattern := `^func ` + t.Name + `\(.* \*testing\.T\)`
-	testFuncPattern := regexp.MustCompile(pattern)
-	return testFuncPattern.MatchString(line)
+// PassedNames returns the names of the tests that passed.
+func (g *GeneratedTests) PassedNames() []string {
+	var names []string
+	for _, test := range g.Passed {
+		names = append(names, test.Name)
+	}
+	return names
 }
 
-func (t *Test) removeFrom(file *os.File) error {
-	if _, err := file.Seek(0, io.SeekStart); err != nil {
-		return fmt.Errorf("file.Seek(0, io.SeekStart): %w", err)
+// keptHelpers returns the helpers already written that the generation doesn't redeclare
+// and that the kept tests or the generation still use.
+func (g *GeneratedTests) keptHelpers(llmTest *LLMGeneratedTest) []Decl {
+	redeclared := make(map[string]bool)
+	for _, helper := range llmTest.Helpers {
+		for _, name := range helper.Names {
+			redeclared[name] = true
+		}
 	}
 
-	var buffer bytes.Buffer
-	scanner := bufio.NewScanner(file)
-	inTestFunction := false
-	braceCount := 0
+	var candidates []Decl
+	for _, helper := range g.Helpers {
+		if !slices.ContainsFunc(helper.Names, func(name string) bool { return redeclared[name] }) {
+			candidates = append(candidates, helper)
+		}
+	}
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		trimmedLine := strings.TrimSpace(line)
+	var sources []string
+	for _, test := range append(slices.Clone(g.Passed), llmTest.Tests...) {
+		sources = append(sources, test.Source)
+	}
+	for _, helper := range llmTest.Helpers {
+		sources = append(sources, helper.Source)
+	}
+	return usedHelpers(candidates, sources)
+}
 
-		if inTestFunction {
-			if strings.Contains(trimmedLine, "{") {
-				braceCount++
-			}
-			if strings.Contains(trimmedLine, "}") {
-				braceCount--
-			}
-			if braceCount == 0 {
-				inTestFunction = false
-			}
-			continue
+// replacedNames returns the declarations the generation replaces:
+// the failing tests, the tests and helpers it declares again, and the helpers not used anymore.
+func (g *GeneratedTests) replacedNames(llmTest *LLMGeneratedTest, keptHelpers []Decl) []string {
+	kept := make(map[string]bool)
+	for _, helper := range keptHelpers {
+		for _, name := range helper.Names {
+			kept[name] = true
 		}
+	}
 
-		if t.matchesTestFunc(trimmedLine) {
-			inTestFunction = true
-			if strings.Contains(trimmedLine, "{") {
-				braceCount++
+	var names []string
+	for _, test := range append(slices.Clone(g.Failing), llmTest.Tests...) {
+		names = append(names, test.Name)
+	}
+	for _, helper := range g.Helpers {
+		for _, name := range helper.Names {
+			if !kept[name] {
+				names = append(names, name)
 			}
-			continue
 		}
+	}
+	return names
+}
 
-		buffer.WriteString(line + "\n")
+func (g *GeneratedTests) appendTo(src []byte, llmTest *LLMGeneratedTest) []byte {
+	if len(src) == 0 {
+		src = fmt.Appendf(nil, "package %s\n", g.Location.Pkg.Name)
+	}
+	for _, test := range llmTest.Tests {
+		src = fmt.Appendf(src, "\n%s\n%s\n", generatedMarker, test.Source)
 	}
+	for _, helper := range llmTest.Helpers {
+		src = fmt.Appendf(src, "\n%s\n%s\n", generatedMarker, withHelperCall(helper.Source))
+	}
+	return src
+}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("scanner.Err(): %w", err)
+// usedHelpers returns the helpers the sources use, directly or through other helpers.
+// A method is used with its receiver type.
+func usedHelpers(helpers []Decl, sources []string) []Decl {
+	used := make(map[string]bool)
+	for _, source := range sources {
+		addIdents(used, source)
 	}
 
-	err := os.WriteFile(t.Path, buffer.Bytes(), 0644)
-	if err != nil {
-		return fmt.Errorf("os.WriteFile(): %w", err)
+	isUsed := func(helper Decl) bool {
+		return slices.ContainsFunc(helper.Names, func(name string) bool {
+			recv, _, _ := strings.Cut(name, ".")
+			return used[name] || used[recv]
+		})
 	}
 
-	return nil
+	var result []Decl
+	remaining := helpers
+	for found := true; found; {
+		found = false
+		var unused []Decl
+		for _, helper := range remaining {
+			if isUsed(helper) {
+				result = append(result, helper)
+				addIdents(used, helper.Source)
+				found = true
+			} else {
+				unused = append(unused, helper)
+			}
+		}
+		remaining = unused
+	}
+	return result
 }
 
-func (t *Test) writeTo(file *os.File) error {
-	content := t.Test + "\n"
-
-	stat, err := file.Stat()
+// addIdents adds the identifiers of the Go declarations in source to idents.
+func addIdents(idents map[string]bool, source string) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", decorateWithPackage(source), 0)
 	if err != nil {
-		return fmt.Errorf("file.Stat(): %w", err)
+		return
 	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok {
+			idents[ident.Name] = true
+		}
+		return true
+	})
+}
 
-	if stat.Size() == 0 {
-		content = fmt.Sprintf("package %s\n\n%s", t.Package.Name, content)
+// removeDecls removes the top-level declarations declaring any of the names from the source, with their doc comments.
+// The declarations declaring any of the generated names are only removed when chattest wrote them.
+func removeDecls(src []byte, names []string, generated []string) ([]byte, error) {
+	if len(src) == 0 {
+		return src, nil
 	}
 
-	if err := writeContentToFile(file, content); err != nil {
-		return fmt.Errorf("writeContentToFile(): %w", err)
+	fset := token.NewFileSet()
+	node, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("parser.ParseFile(): %w", err)
 	}
 
-	return nil
-}
+	removed := make(map[string]bool)
+	for _, name := range names {
+		removed[name] = true
+	}
 
-func writeContentToFile(file *os.File, content string) error {
-	n, err := file.WriteString(content)
-	if err != nil {
-		return fmt.Errorf("file.WriteString(): %w", err)
+	removedIfGenerated := make(map[string]bool)
+	for _, name := range generated {
+		removedIfGenerated[name] = true
 	}
-	if n != len(content) {
-		return fmt.Errorf("file.WriteString(): wrote %d bytes, expected %d", n, len(content))
+
+	var content bytes.Buffer
+	last := 0
+	for _, decl := range node.Decls {
+		isRemoved := func(name string) bool {
+			return removed[name] || removedIfGenerated[name] && isGenerated(decl)
+		}
+		if !slices.ContainsFunc(declNames(decl), isRemoved) {
+			continue
+		}
+		start := fset.Position(decl.Pos()).Offset
+		if doc := declDoc(decl); doc != nil {
+			start = fset.Position(doc.Pos()).Offset
+		}
+		content.Write(src[last:start])
+		last = fset.Position(decl.End()).Offset
 	}
-	return nil
+	content.Write(src[last:])
+
+	return content.Bytes(), nil
 }
 
-func fixImports(file *os.File) error {
-	fileContentWithImports, err := imports.Process(file.Name(), nil, nil)
+// addImport adds the import to the source, unless it is already there.
+// name is the name the package is imported as, or "" for its own name.
+func addImport(src []byte, name string, importPath string) ([]byte, error) {
+	fset := token.NewFileSet()
+	node, err := parser.ParseFile(fset, "", src, parser.ParseComments)
 	if err != nil {
-		return fmt.Errorf("imports.Process(): %w", err)
-	}
-
-	if err := file.Truncate(0); err != nil {
-		return fmt.Errorf("file.Truncate(): %w", err)
+		return nil, fmt.Errorf("parser.ParseFile(): %w", err)
 	}
 
-	if _, err := file.Seek(0, 0); err != nil {
-		return fmt.Errorf("file.Seek(): %w", err)
+	if !astutil.AddNamedImport(fset, node, name, importPath) {
+		return src, nil
 	}
 
-	if err := writeContentToFile(file, string(fileContentWithImports)); err != nil {
-		return fmt.Errorf("writeContentToFile(): %w", err)
+	var content bytes.Buffer
+	if err := format.Node(&content, fset, node); err != nil {
+		return nil, fmt.Errorf("format.Node(): %w", err)
 	}
 
-	return nil
+	return content.Bytes(), nil
 }
 
 func fileExists(path string) bool {
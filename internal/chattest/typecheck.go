@@ -0,0 +1,190 @@
+package chattest
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// maxTypeErrors is how many type errors are reported, like the go command does.
+const maxTypeErrors = 10
+
+// typeCheck type-checks the content of the test file at location against the loaded packages,
+// with the other files of its package, so compile errors are found without writing the file and running go test.
+// It returns the compile errors, one per line, or "" when there are none
+// or when the package can't be type-checked in memory, in which case go test tells:
+// a package that wasn't loaded is imported from export data, with its own copies of the loaded packages it depends on,
+// so its types don't match theirs and the errors can be wrong.
+func typeCheck(project *Project, location *TestLocation, content []byte) (string, error) {
+	pkg, others := testPackage(project.Packages, location)
+
+	fset := token.NewFileSet()
+	if len(project.Packages) > 0 {
+		// the files of the loaded packages are positioned in their file set
+		fset = project.Packages[0].Fset
+	}
+
+	// the files parsed here are removed from the file set once checked, so it doesn't grow with every generation
+	file, err := parser.ParseFile(fset, location.Path, content, parser.ParseComments)
+	defer removeFiles(fset, file)
+	if err != nil {
+		return "", fmt.Errorf("parser.ParseFile(): %w", err)
+	}
+
+	files := []*ast.File{file}
+	for _, other := range others {
+		if fset.File(other.Pos()).Name() != location.Path {
+			files = append(files, other)
+		}
+	}
+
+	// i.e. the helper of the property strategy, written after the packages were loaded
+	extra, err := unloadedTestFiles(fset, location, files)
+	if err != nil {
+		return "", fmt.Errorf("unloadedTestFiles(): %w", err)
+	}
+	defer removeFiles(fset, extra...)
+	files = append(files, extra...)
+
+	var typeErrors []string
+	unresolved := false
+	pkgImporter := newPackagesImporter(project.Packages, fset)
+	config := types.Config{
+		Importer: pkgImporter,
+		Error: func(err error) {
+			typeErr, ok := err.(types.Error)
+			if !ok {
+				return
+			}
+			if strings.Contains(typeErr.Msg, "could not import") {
+				unresolved = true
+			}
+			if fset.Position(typeErr.Pos).Filename == location.Path && len(typeErrors) < maxTypeErrors {
+				typeErrors = append(typeErrors, typeErr.Msg)
+			}
+		},
+	}
+	// the features newer than the go directive of the module are errors, as they are for the go command
+	if project.Module != nil {
+		config.GoVersion = goLang(project.Module.GoVersion)
+	}
+
+	path := location.Pkg.ImportPath()
+	if pkg != nil {
+		path = pkg.PkgPath
+	}
+	_, _ = config.Check(path, fset, files, nil)
+
+	if unresolved || pkgImporter.usedFallback || len(typeErrors) == 0 {
+		return "", nil
+	}
+	return strings.Join(typeErrors, "\n") + "\n", nil
+}
+
+// testPackage returns the loaded package the test file belongs to, and its files.
+// That's the test variant of the package, which also has the test files, or the external test package.
+// The package is nil when it wasn't loaded, i.e. an external test package without any file yet.
+func testPackage(pkgs []*packages.Package, location *TestLocation) (*packages.Package, []*ast.File) {
+	importPath := location.Pkg.ImportPath()
+	if strings.HasSuffix(location.Pkg.Name, "_test") {
+		importPath += "_test"
+	}
+
+	var found *packages.Package
+	for _, pkg := range pkgs {
+		if pkg.PkgPath != importPath {
+			continue
+		}
+		// the test variant, "a/b [a/b.test]", has the files of "a/b" and its test files
+		if found == nil || strings.HasSuffix(pkg.ID, ".test]") {
+			found = pkg
+		}
+	}
+
+	if found == nil {
+		return nil, nil
+	}
+	return found, found.Syntax
+}
+
+// unloadedTestFiles parses the test files of the package's directory that are not among files.
+func unloadedTestFiles(fset *token.FileSet, location *TestLocation, files []*ast.File) ([]*ast.File, error) {
+	paths, err := filepath.Glob(filepath.Join(filepath.Dir(location.Path), "*_test.go"))
+	if err != nil {
+		return nil, fmt.Errorf("filepath.Glob(): %w", err)
+	}
+
+	var extra []*ast.File
+	for _, path := range paths {
+		if slices.ContainsFunc(files, func(file *ast.File) bool { return fset.File(file.Pos()).Name() == path }) {
+			continue
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("os.ReadFile(): %w", err)
+		}
+		file, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+		if err != nil || file.Name.Name != location.Pkg.Name {
+			removeFiles(fset, file)
+			continue
+		}
+		extra = append(extra, file)
+	}
+	return extra, nil
+}
+
+// removeFiles removes the parsed files from the file set, nil ones included.
+func removeFiles(fset *token.FileSet, files ...*ast.File) {
+	for _, file := range files {
+		if file == nil {
+			continue
+		}
+		if tokenFile := fset.File(file.Pos()); tokenFile != nil {
+			fset.RemoveFile(tokenFile)
+		}
+	}
+}
+
+// packagesImporter imports the loaded packages, preferring the test variants,
+// as an external test package sees the test files of the package it tests.
+// The packages that weren't loaded, i.e. a standard package only the test uses, are imported from export data.
+type packagesImporter struct {
+	loaded   map[string]*types.Package
+	fallback types.Importer
+	// usedFallback tells whether a package was imported from export data.
+	usedFallback bool
+}
+
+func newPackagesImporter(pkgs []*packages.Package, fset *token.FileSet) *packagesImporter {
+	loaded := make(map[string]*types.Package)
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if pkg.Types == nil || strings.HasSuffix(pkg.PkgPath, ".test") {
+			return
+		}
+		if _, found := loaded[pkg.PkgPath]; !found || strings.HasSuffix(pkg.ID, ".test]") {
+			loaded[pkg.PkgPath] = pkg.Types
+		}
+	})
+
+	return &packagesImporter{
+		loaded:   loaded,
+		fallback: importer.ForCompiler(fset, "gc", nil),
+	}
+}
+
+func (i *packagesImporter) Import(path string) (*types.Package, error) {
+	if pkg, found := i.loaded[path]; found {
+		return pkg, nil
+	}
+	i.usedFallback = true
+	return i.fallback.Import(path)
+}
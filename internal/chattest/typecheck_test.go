@@ -0,0 +1,88 @@
+package chattest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTypeCheckWithUnloadedImport(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/handler\n\ngo 1.21\n",
+		"handler.go": `package handler
+
+import "net/http"
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusTeapot)
+}
+`,
+		// so testing is loaded, as it is for a package with tests
+		"other_test.go": "package handler\n\nimport \"testing\"\n\nfunc TestOther(t *testing.T) {}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	project, err := LoadPackages(&Config{RepoPath: dir, FuncPath: filepath.Join(dir, "handler.go"), FuncName: "Handler"})
+	if err != nil {
+		t.Fatalf("LoadPackages(): %v", err)
+	}
+	location := project.FocalMethod.InferTestLocation()
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{
+			name: "valid test importing a package that isn't loaded",
+			content: `package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	Handler(rec, req)
+	if rec.Code != http.StatusTeapot {
+		t.Fatalf("got %d", rec.Code)
+	}
+}
+`,
+		},
+		{
+			name: "invalid test importing loaded packages only",
+			content: `package handler
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	Handler(nil, http.MethodGet)
+}
+`,
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			compileErrors, err := typeCheck(project, location, []byte(tc.content))
+			if err != nil {
+				t.Fatalf("typeCheck(): %v", err)
+			}
+			if got := compileErrors != ""; got != tc.wantErr {
+				t.Errorf("typeCheck() = %q, want errors: %t", compileErrors, tc.wantErr)
+			}
+		})
+	}
+}
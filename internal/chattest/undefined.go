@@ -0,0 +1,337 @@
+package chattest
+
+import (
+	"go/types"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Suggestion points a name the LLM made up to the real symbols closest to it.
+type Suggestion struct {
+	// Undefined is the made up name, i.e. "NewClientWithOpts" or "Store.FetchAll".
+	Undefined string
+	// Closest are the names of the real symbols closest to it.
+	Closest []string
+	// Definitions are the source code of the Closest symbols.
+	Definitions []string
+}
+
+var (
+	// i.e. "undefined: NewOp" or "undefined: strings.NoSuch"
+	undefinedPattern = regexp.MustCompile(`^undefined: (?:(\w+)\.)?(\w+)`)
+	// i.e. "s.FetchAll undefined (type *Store has no field or method FetchAll)"
+	undefinedMemberPattern = regexp.MustCompile(`^\S+ undefined \(type (\S+) has no field or method (\w+)`)
+	// i.e. "unknown field Nme in struct literal of type Op"
+	unknownFieldPattern = regexp.MustCompile(`^unknown field (\w+) in struct literal(?: of type)? (\S+)`)
+)
+
+const maxClosest = 3
+
+// suggestDefinitions finds the undefined names in the compile errors of the test at location,
+// and looks up the closest real symbols in the loaded packages.
+func suggestDefinitions(project *Project, location *TestLocation, compileError string) []Suggestion {
+	lookup := newSymbolLookup(project.Packages, location)
+
+	var suggestions []Suggestion
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(compileError, "\n") {
+		var suggestion Suggestion
+		var found bool
+		if match := undefinedMemberPattern.FindStringSubmatch(line); match != nil {
+			suggestion, found = lookup.member(match[1], match[2])
+		} else if match := unknownFieldPattern.FindStringSubmatch(line); match != nil {
+			suggestion, found = lookup.member(match[2], match[1])
+		} else if match := undefinedPattern.FindStringSubmatch(line); match != nil {
+			suggestion, found = lookup.object(match[1], match[2])
+		}
+
+		if found && !seen[suggestion.Undefined] {
+			seen[suggestion.Undefined] = true
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+	return suggestions
+}
+
+type symbolLookup struct {
+	pkgs []*packages.Package
+	// scopes are the packages an unqualified name of the test can come from:
+	// its own package, and the package under test for an external test package.
+	scopes []*packages.Package
+	// path is the import path of the package of the test.
+	path string
+}
+
+func newSymbolLookup(pkgs []*packages.Package, location *TestLocation) *symbolLookup {
+	lookup := &symbolLookup{path: location.Pkg.ImportPath()}
+	if strings.HasSuffix(location.Pkg.Name, "_test") {
+		lookup.path += "_test"
+	}
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if pkg.Types != nil {
+			lookup.pkgs = append(lookup.pkgs, pkg)
+		}
+	})
+
+	if pkg, _ := testPackage(pkgs, location); pkg != nil {
+		lookup.scopes = append(lookup.scopes, pkg)
+	}
+	if strings.HasSuffix(location.Pkg.Name, "_test") {
+		focal := &TestLocation{Pkg: Pkg{ID: location.Pkg.ID, Name: strings.TrimSuffix(location.Pkg.Name, "_test")}}
+		if pkg, _ := testPackage(pkgs, focal); pkg != nil {
+			lookup.scopes = append(lookup.scopes, pkg)
+		}
+	}
+	return lookup
+}
+
+// object suggests package-level symbols for an undefined name, qualified by a package name or not.
+func (l *symbolLookup) object(qualifier, name string) (Suggestion, bool) {
+	scopes := l.scopes
+	undefined := name
+	if qualifier != "" {
+		scopes = l.packagesNamed(qualifier)
+		undefined = qualifier + "." + name
+	}
+
+	var candidates []types.Object
+	for _, pkg := range scopes {
+		scope := pkg.Types.Scope()
+		for _, objName := range scope.Names() {
+			if obj := scope.Lookup(objName); l.accessible(obj) && !isTestFunc(obj) {
+				candidates = append(candidates, obj)
+			}
+		}
+	}
+
+	closest := closestObjects(name, candidates, false)
+	if len(closest) == 0 {
+		return Suggestion{}, false
+	}
+
+	suggestion := Suggestion{Undefined: undefined}
+	for _, obj := range closest {
+		// i.e. a symbol of the package under test for an external test package
+		if qualifier == "" && obj.Pkg().Path() != l.path {
+			suggestion.Closest = append(suggestion.Closest, obj.Pkg().Name()+"."+obj.Name())
+		} else {
+			suggestion.Closest = append(suggestion.Closest, qualifiedName(qualifier, obj.Name()))
+		}
+		suggestion.Definitions = append(suggestion.Definitions, l.definition(obj, nil))
+	}
+	return suggestion, true
+}
+
+// member suggests the fields and methods of the type, as printed by the compiler, for an undefined one.
+// When none is close to the name, all of them are suggested, as a type has few.
+func (l *symbolLookup) member(typeString, name string) (Suggestion, bool) {
+	named := l.namedType(typeString)
+	if named == nil {
+		return Suggestion{}, false
+	}
+
+	var candidates []types.Object
+	methods := types.NewMethodSet(types.NewPointer(named))
+	for i := 0; i < methods.Len(); i++ {
+		if obj := methods.At(i).Obj(); l.accessible(obj) {
+			candidates = append(candidates, obj)
+		}
+	}
+	if structType, ok := named.Underlying().(*types.Struct); ok {
+		for i := 0; i < structType.NumFields(); i++ {
+			if field := structType.Field(i); l.accessible(field) {
+				candidates = append(candidates, field)
+			}
+		}
+	}
+
+	closest := closestObjects(name, candidates, true)
+	if len(closest) == 0 {
+		return Suggestion{}, false
+	}
+
+	typeName := named.Obj().Name()
+	suggestion := Suggestion{Undefined: typeName + "." + name}
+	for _, obj := range closest {
+		suggestion.Closest = append(suggestion.Closest, typeName+"."+obj.Name())
+		definition := l.definition(obj, named)
+		if !slices.Contains(suggestion.Definitions, definition) {
+			suggestion.Definitions = append(suggestion.Definitions, definition)
+		}
+	}
+	return suggestion, true
+}
+
+// namedType finds the type the compiler printed, i.e. "*Store", "calc.Store" or "Cache[int]".
+func (l *symbolLookup) namedType(typeString string) *types.Named {
+	typeString = strings.TrimLeft(typeString, "*")
+	typeString, _, _ = strings.Cut(typeString, "[")
+
+	scopes := l.scopes
+	qualifier, name, qualified := strings.Cut(typeString, ".")
+	if !qualified {
+		name = qualifier
+	} else {
+		scopes = l.packagesNamed(qualifier)
+	}
+
+	for _, pkg := range scopes {
+		if typeName, ok := pkg.Types.Scope().Lookup(name).(*types.TypeName); ok {
+			if named, ok := typeName.Type().(*types.Named); ok {
+				return named
+			}
+		}
+	}
+	return nil
+}
+
+// accessible tells whether the test can use the object: it's exported or declared in the package of the test.
+func (l *symbolLookup) accessible(obj types.Object) bool {
+	return obj.Exported() || obj.Pkg() != nil && obj.Pkg().Path() == l.path
+}
+
+// packagesNamed returns the loaded packages with the name, one per import path.
+// That's the package itself rather than its test variant, as other packages import it.
+func (l *symbolLookup) packagesNamed(name string) []*packages.Package {
+	byPath := make(map[string]*packages.Package)
+	var paths []string
+	for _, pkg := range l.pkgs {
+		if pkg.Name != name {
+			continue
+		}
+		if found, ok := byPath[pkg.PkgPath]; !ok {
+			paths = append(paths, pkg.PkgPath)
+		} else if !strings.HasSuffix(found.ID, ".test]") {
+			continue
+		}
+		byPath[pkg.PkgPath] = pkg
+	}
+
+	var named []*packages.Package
+	for _, path := range paths {
+		named = append(named, byPath[path])
+	}
+	return named
+}
+
+// definition returns the source code of the object, or its signature when its source isn't loaded,
+// i.e. a standard package loaded from export data.
+// A field is defined by its struct type, recv is the type of a field or a method.
+func (l *symbolLookup) definition(obj types.Object, recv *types.Named) string {
+	target := obj
+	var recvName *string
+	switch {
+	case recv != nil && !isMethod(obj):
+		target = recv.Obj()
+	case recv != nil:
+		name := recv.Obj().Name()
+		recvName = &name
+	}
+
+	if target.Pkg() != nil {
+		for _, pkg := range l.pkgs {
+			if pkg.PkgPath != target.Pkg().Path() || len(pkg.Syntax) == 0 {
+				continue
+			}
+			def := findDefinition(pkg, target.Name(), recvName)
+			if def.body == "" {
+				continue
+			}
+			if _, ok := target.(*types.TypeName); ok {
+				return "type " + def.body
+			}
+			return def.body
+		}
+	}
+
+	return types.ObjectString(target, types.RelativeTo(target.Pkg()))
+}
+
+// isTestFunc tells whether the object is a test, benchmark, fuzz test or example, which tests don't call.
+func isTestFunc(obj types.Object) bool {
+	if _, ok := obj.(*types.Func); !ok {
+		return false
+	}
+	for _, kind := range []Kind{KindTest, KindFuzz, KindBench, KindExample} {
+		if strings.HasPrefix(obj.Name(), kind.funcPrefix()) {
+			return true
+		}
+	}
+	return false
+}
+
+func isMethod(obj types.Object) bool {
+	fn, ok := obj.(*types.Func)
+	return ok && fn.Type().(*types.Signature).Recv() != nil
+}
+
+func qualifiedName(qualifier, name string) string {
+	if qualifier == "" {
+		return name
+	}
+	return qualifier + "." + name
+}
+
+// closestObjects returns the objects whose names are the closest to name, at most maxClosest of them.
+// With all set, all objects are returned when none is close, sorted by name.
+func closestObjects(name string, objects []types.Object, all bool) []types.Object {
+	type candidate struct {
+		obj      types.Object
+		distance int
+	}
+
+	var close []candidate
+	lowerName := strings.ToLower(name)
+	for _, obj := range objects {
+		lowerObj := strings.ToLower(obj.Name())
+		distance := levenshtein(lowerName, lowerObj)
+		if distance <= max(2, len(name)/2) || strings.Contains(lowerObj, lowerName) || strings.Contains(lowerName, lowerObj) && len(lowerObj) >= 3 {
+			close = append(close, candidate{obj, distance})
+		}
+	}
+
+	if len(close) == 0 && all {
+		sorted := slices.Clone(objects)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name() < sorted[j].Name() })
+		return sorted
+	}
+
+	sort.SliceStable(close, func(i, j int) bool {
+		if close[i].distance != close[j].distance {
+			return close[i].distance < close[j].distance
+		}
+		return close[i].obj.Name() < close[j].obj.Name()
+	})
+
+	var closest []types.Object
+	for i := 0; i < len(close) && i < maxClosest; i++ {
+		closest = append(closest, close[i].obj)
+	}
+	return closest
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
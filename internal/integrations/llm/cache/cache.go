@@ -0,0 +1,245 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pleto.dev/chattest/internal/integrations/llm"
+)
+
+const entryExt = ".json"
+
+type Config struct {
+	// Dir is where cache entries are stored. Defaults to DefaultDir().
+	Dir string
+	// TTL is how long an entry is served after it was written. Zero means entries never expire.
+	TTL time.Duration
+	// MaxBytes caps the total size of the cache directory. Zero means no limit.
+	MaxBytes int64
+}
+
+// DefaultDir returns the chattest directory inside the user cache directory.
+func DefaultDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("os.UserCacheDir(): %w", err)
+	}
+	return filepath.Join(dir, "chattest", "llm"), nil
+}
+
+type entry struct {
+	CreatedAt time.Time                   `json:"created_at"`
+	Response  *llm.ChatCompletionResponse `json:"response"`
+}
+
+// Client is an llm.LLM decorator that stores responses on disk, addressed by llm.RequestKey,
+// so identical prompts are only paid for once.
+type Client struct {
+	llm      llm.LLM
+	dir      string
+	ttl      time.Duration
+	maxBytes int64
+
+	// mu serializes writes and evictions within the process
+	mu sync.Mutex
+}
+
+var _ llm.StreamingLLM = &Client{}
+
+func NewClient(llm llm.LLM, cfg Config) (*Client, error) {
+	dir := cfg.Dir
+	if dir == "" {
+		defaultDir, err := DefaultDir()
+		if err != nil {
+			return nil, fmt.Errorf("DefaultDir(): %w", err)
+		}
+		dir = defaultDir
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("os.MkdirAll(): %w", err)
+	}
+
+	return &Client{
+		llm:      llm,
+		dir:      dir,
+		ttl:      cfg.TTL,
+		maxBytes: cfg.MaxBytes,
+	}, nil
+}
+
+func (c *Client) CreateChatCompletion(ctx context.Context, request *llm.CreateChatCompletionRequest) (*llm.ChatCompletionResponse, error) {
+	return c.CreateChatCompletionStream(ctx, request, nil)
+}
+
+// CreateChatCompletionStream streams from the wrapped LLM on a miss.
+// A cached response is handed out as a single delta.
+func (c *Client) CreateChatCompletionStream(ctx context.Context, request *llm.CreateChatCompletionRequest, onDelta func(delta string)) (*llm.ChatCompletionResponse, error) {
+	key := llm.RequestKey(request)
+
+	if response, found := c.get(key); found {
+		if onDelta != nil {
+			onDelta(response.Content)
+		}
+		return response, nil
+	}
+
+	response, err := llm.Stream(ctx, c.llm, request, onDelta)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.put(key, response); err != nil {
+		return nil, fmt.Errorf("put(): %w", err)
+	}
+
+	return response, nil
+}
+
+// get returns the cached response for key.
+// Unreadable or expired entries are treated as misses.
+func (c *Client) get(key string) (*llm.ChatCompletionResponse, bool) {
+	path := c.path(key)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil || e.Response == nil {
+		return nil, false
+	}
+
+	if c.ttl > 0 && time.Since(e.CreatedAt) > c.ttl {
+		return nil, false
+	}
+
+	// the modification time tracks the last use, which drives eviction
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+
+	response := *e.Response
+	response.Cached = true
+	return &response, true
+}
+
+func (c *Client) put(key string, response *llm.ChatCompletionResponse) error {
+	data, err := json.Marshal(entry{
+		CreatedAt: time.Now(),
+		Response:  response,
+	})
+	if err != nil {
+		return fmt.Errorf("json.Marshal(): %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// write to a temporary file first, so a concurrent reader never sees a partial entry
+	tmp, err := os.CreateTemp(c.dir, key+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("os.CreateTemp(): %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := writeAndClose(tmp, data); err != nil {
+		return fmt.Errorf("writeAndClose(): %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), c.path(key)); err != nil {
+		return fmt.Errorf("os.Rename(): %w", err)
+	}
+
+	if err := c.evict(); err != nil {
+		return fmt.Errorf("evict(): %w", err)
+	}
+
+	return nil
+}
+
+func writeAndClose(file *os.File, data []byte) error {
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("file.Write(): %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("file.Close(): %w", err)
+	}
+	return nil
+}
+
+type cachedFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// evict removes expired entries, then the least recently used ones until the cache fits in maxBytes.
+func (c *Client) evict() error {
+	dirEntries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("os.ReadDir(): %w", err)
+	}
+
+	var files []cachedFile
+	var total int64
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() || !strings.HasSuffix(dirEntry.Name(), entryExt) {
+			continue
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(c.dir, dirEntry.Name())
+		// hits only move the modification time forward, so an entry unused for longer than the TTL is expired
+		if c.ttl > 0 && time.Since(info.ModTime()) > c.ttl {
+			if err := removeIfExists(path); err != nil {
+				return err
+			}
+			continue
+		}
+		files = append(files, cachedFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+	}
+
+	if c.maxBytes <= 0 || total <= c.maxBytes {
+		return nil
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	for _, file := range files {
+		if total <= c.maxBytes {
+			break
+		}
+		if err := removeIfExists(file.path); err != nil {
+			return err
+		}
+		total -= file.size
+	}
+
+	return nil
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("os.Remove(): %w", err)
+	}
+	return nil
+}
+
+func (c *Client) path(key string) string {
+	return filepath.Join(c.dir, key+entryExt)
+}
@@ -0,0 +1,181 @@
+package cassette
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"pleto.dev/chattest/internal/integrations/llm"
+)
+
+// Mode tells the cassette whether to record new interactions or to replay recorded ones.
+type Mode string
+
+const (
+	// ModeRecord forwards every request to the wrapped LLM and writes the interaction to the cassette.
+	ModeRecord Mode = "record"
+	// ModeReplay serves responses from the cassette and never calls the wrapped LLM.
+	ModeReplay Mode = "replay"
+)
+
+// ErrNotRecorded is returned in replay mode when the cassette has no response for a request.
+var ErrNotRecorded = errors.New("request not recorded in cassette")
+
+type Config struct {
+	Path string
+	Mode Mode
+}
+
+// Interaction is a single request/response pair stored in a cassette.
+type Interaction struct {
+	Key      string                           `json:"key"`
+	Request  *llm.CreateChatCompletionRequest `json:"request"`
+	Response *llm.ChatCompletionResponse      `json:"response"`
+}
+
+type cassetteFile struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Client is an llm.LLM decorator that records interactions with the wrapped LLM to a file,
+// or replays them from it, so a whole session can be re-run offline.
+type Client struct {
+	llm  llm.LLM
+	path string
+	mode Mode
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	// replayed counts how many times each key was served, so that a request
+	// sent several times is answered with the recorded responses in order
+	replayed map[string]int
+}
+
+var _ llm.StreamingLLM = &Client{}
+
+// NewClient wraps the given LLM with a cassette.
+// In replay mode the wrapped LLM is never called and may be nil.
+func NewClient(llm llm.LLM, cfg Config) (*Client, error) {
+	c := &Client{
+		llm:      llm,
+		path:     cfg.Path,
+		mode:     cfg.Mode,
+		replayed: make(map[string]int),
+	}
+
+	switch cfg.Mode {
+	case ModeRecord:
+		// start from an empty cassette, so a recording always reflects one session
+		if err := c.save(); err != nil {
+			return nil, fmt.Errorf("save(): %w", err)
+		}
+	case ModeReplay:
+		if err := c.load(); err != nil {
+			return nil, fmt.Errorf("load(): %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown cassette mode %q, expected %q or %q", cfg.Mode, ModeRecord, ModeReplay)
+	}
+
+	return c, nil
+}
+
+func (c *Client) CreateChatCompletion(ctx context.Context, request *llm.CreateChatCompletionRequest) (*llm.ChatCompletionResponse, error) {
+	return c.CreateChatCompletionStream(ctx, request, nil)
+}
+
+// CreateChatCompletionStream streams from the wrapped LLM when recording.
+// A replayed response is handed out as a single delta.
+func (c *Client) CreateChatCompletionStream(ctx context.Context, request *llm.CreateChatCompletionRequest, onDelta func(delta string)) (*llm.ChatCompletionResponse, error) {
+	key := llm.RequestKey(request)
+
+	if c.mode == ModeReplay {
+		response, err := c.replay(key)
+		if err != nil {
+			return nil, err
+		}
+		if onDelta != nil {
+			onDelta(response.Content)
+		}
+		return response, nil
+	}
+
+	response, err := llm.Stream(ctx, c.llm, request, onDelta)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.record(key, request, response); err != nil {
+		return nil, fmt.Errorf("record(): %w", err)
+	}
+
+	return response, nil
+}
+
+func (c *Client) replay(key string) (*llm.ChatCompletionResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var matches []*Interaction
+	for _, interaction := range c.interactions {
+		if interaction.Key == key {
+			matches = append(matches, interaction)
+		}
+	}
+
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%w: key %s", ErrNotRecorded, key)
+	}
+
+	// once the recorded responses are exhausted, keep serving the last one
+	i := min(c.replayed[key], len(matches)-1)
+	c.replayed[key]++
+
+	response := *matches[i].Response
+	return &response, nil
+}
+
+func (c *Client) record(key string, request *llm.CreateChatCompletionRequest, response *llm.ChatCompletionResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.interactions = append(c.interactions, &Interaction{
+		Key:      key,
+		Request:  request,
+		Response: response,
+	})
+
+	// the cassette is saved after every interaction, so an interrupted session is still replayable
+	return c.save()
+}
+
+func (c *Client) load() error {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return fmt.Errorf("os.ReadFile(): %w", err)
+	}
+
+	var file cassetteFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("json.Unmarshal(): %w", err)
+	}
+
+	c.interactions = file.Interactions
+	return nil
+}
+
+func (c *Client) save() error {
+	data, err := json.MarshalIndent(cassetteFile{Interactions: c.interactions}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent(): %w", err)
+	}
+
+	if err := os.WriteFile(c.path, data, 0644); err != nil {
+		return fmt.Errorf("os.WriteFile(): %w", err)
+	}
+
+	return nil
+}
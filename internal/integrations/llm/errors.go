@@ -0,0 +1,64 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Kinds of LLM failures callers may want to react to. Test for them with errors.Is.
+var (
+	ErrRateLimited           = errors.New("rate limited")
+	ErrContextLengthExceeded = errors.New("context length exceeded")
+	ErrContentFiltered       = errors.New("content filtered")
+	ErrAuthFailed            = errors.New("authentication failed")
+	ErrEmptyResponse         = errors.New("empty response")
+)
+
+// APIError is a failed call to the LLM provider, with the details needed to decide how to recover.
+type APIError struct {
+	// Kind is one of the Err* kinds above, or nil if the failure is none of them.
+	Kind error
+	// StatusCode is the HTTP status code of the response, or 0 if no response was received.
+	StatusCode int
+	// RetryAfter is how long the provider asked to wait before retrying, or 0 if it didn't say.
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *APIError) Error() string {
+	if e.StatusCode == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("status %d: %s", e.StatusCode, e.Err)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is(err, ErrRateLimited) and the like match on the Kind.
+func (e *APIError) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+// Retryable reports whether sending the same request again may succeed.
+func (e *APIError) Retryable() bool {
+	switch {
+	case e.Kind == ErrRateLimited:
+		return true
+	case e.Kind != nil:
+		// the other kinds fail the same way for the same request
+		return false
+	case e.StatusCode == 0:
+		// no response at all, i.e. a dropped connection
+		return true
+	case e.StatusCode == http.StatusRequestTimeout,
+		e.StatusCode == http.StatusTooManyRequests:
+		return true
+	case e.StatusCode >= http.StatusInternalServerError:
+		return true
+	}
+	return false
+}
@@ -1,12 +1,19 @@
 package llm
 
-import "context"
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
 
 type LLM interface {
 	CreateChatCompletion(context.Context, *CreateChatCompletionRequest) (*ChatCompletionResponse, error)
 }
 
 type CreateChatCompletionRequest struct {
+	// Model is the model to use; an empty Model lets the provider pick its default.
+	Model    string
 	Messages []ChatCompletionMessage
 }
 
@@ -17,4 +24,71 @@ type ChatCompletionMessage struct {
 
 type ChatCompletionResponse struct {
 	Content string
+	// Cached is set when the response was served from a cache instead of the provider.
+	Cached bool `json:"-"`
+}
+
+// RequestKey returns a stable hash of everything in the request that can influence the response.
+// Two requests with the same key are expected to produce equivalent completions.
+func RequestKey(request *CreateChatCompletionRequest) string {
+	// encoding/json writes struct fields in declaration order, so the encoding is stable
+	data, _ := json.Marshal(request)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Middleware decorates an LLM with extra behaviour, i.e. caching or retries.
+type Middleware func(LLM) LLM
+
+// Chain wraps llm with the middlewares. The first middleware is the outermost,
+// so it sees a request first and a response last.
+func Chain(llm LLM, middlewares ...Middleware) LLM {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		llm = middlewares[i](llm)
+	}
+	return llm
+}
+
+// EstimateTokens roughly estimates the number of tokens in a text.
+// It uses the rule of thumb of 4 characters per token for English text and code.
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// EstimateRequestTokens roughly estimates the number of prompt tokens of a request.
+func EstimateRequestTokens(request *CreateChatCompletionRequest) int {
+	// every message carries a few tokens of overhead for its role and delimiters
+	const messageOverhead = 4
+	tokens := 0
+	for _, message := range request.Messages {
+		tokens += messageOverhead + EstimateTokens(message.Content)
+	}
+	return tokens
+}
+
+// StreamingLLM is an LLM that can hand out the completion while it is being generated.
+type StreamingLLM interface {
+	LLM
+	// CreateChatCompletionStream calls onDelta with every piece of the completion as it arrives,
+	// and returns the whole completion at the end, like CreateChatCompletion.
+	CreateChatCompletionStream(ctx context.Context, request *CreateChatCompletionRequest, onDelta func(delta string)) (*ChatCompletionResponse, error)
+}
+
+// Stream streams the completion if llm supports it. Otherwise, or if onDelta is nil,
+// it falls back to CreateChatCompletion and hands out the whole completion as a single delta.
+func Stream(ctx context.Context, llm LLM, request *CreateChatCompletionRequest, onDelta func(delta string)) (*ChatCompletionResponse, error) {
+	if streaming, ok := llm.(StreamingLLM); ok && onDelta != nil {
+		return streaming.CreateChatCompletionStream(ctx, request, onDelta)
+	}
+
+	response, err := llm.CreateChatCompletion(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if onDelta != nil {
+		onDelta(response.Content)
+	}
+
+	return response, nil
 }
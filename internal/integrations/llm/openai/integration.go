@@ -2,30 +2,117 @@ package openai
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/sashabaranov/go-openai"
 	"pleto.dev/chattest/internal/integrations/llm"
 )
 
+const DefaultModel = "gpt-4o-mini"
+
 type Config struct {
 	APIKey string
+	// Model is used for requests that don't name one. Defaults to DefaultModel.
+	Model string
 }
 
 type Client struct {
 	openai *openai.Client
+	model  string
 }
 
-var _ llm.LLM = &Client{}
+var _ llm.StreamingLLM = &Client{}
 
 func NewClient(cfg Config) *Client {
 	openAIConfig := openai.DefaultConfig(cfg.APIKey)
+	openAIConfig.HTTPClient = &http.Client{
+		Transport: &retryAfterTransport{base: http.DefaultTransport},
+	}
+	model := cfg.Model
+	if model == "" {
+		model = DefaultModel
+	}
 	return &Client{
 		openai: openai.NewClientWithConfig(openAIConfig),
+		model:  model,
 	}
 }
 
 func (c *Client) CreateChatCompletion(ctx context.Context, request *llm.CreateChatCompletionRequest) (*llm.ChatCompletionResponse, error) {
+	ctx, retryAfter := withRetryAfterHolder(ctx)
+
+	resp, err := c.openai.CreateChatCompletion(ctx, c.chatCompletionRequest(request))
+	if err != nil {
+		return nil, fmt.Errorf("openai.CreateChatCompletion(): %w", apiError(err, retryAfter.get()))
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("openai.CreateChatCompletion(): no choices: %w", llm.ErrEmptyResponse)
+	}
+
+	choice := resp.Choices[0]
+	if err := checkCompletion(choice.Message.Content, choice.FinishReason); err != nil {
+		return nil, fmt.Errorf("openai.CreateChatCompletion(): %w", err)
+	}
+
+	return &llm.ChatCompletionResponse{
+		Content: choice.Message.Content,
+	}, nil
+}
+
+// CreateChatCompletionStream reads the completion from the server-sent events stream of the API.
+func (c *Client) CreateChatCompletionStream(ctx context.Context, request *llm.CreateChatCompletionRequest, onDelta func(delta string)) (*llm.ChatCompletionResponse, error) {
+	ctx, retryAfter := withRetryAfterHolder(ctx)
+
+	openAIRequest := c.chatCompletionRequest(request)
+	openAIRequest.Stream = true
+
+	stream, err := c.openai.CreateChatCompletionStream(ctx, openAIRequest)
+	if err != nil {
+		return nil, fmt.Errorf("openai.CreateChatCompletionStream(): %w", apiError(err, retryAfter.get()))
+	}
+	defer stream.Close()
+
+	var content strings.Builder
+	var finishReason openai.FinishReason
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("stream.Recv(): %w", apiError(err, retryAfter.get()))
+		}
+
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		choice := chunk.Choices[0]
+		if choice.FinishReason != "" {
+			finishReason = choice.FinishReason
+		}
+		if choice.Delta.Content != "" {
+			content.WriteString(choice.Delta.Content)
+			onDelta(choice.Delta.Content)
+		}
+	}
+
+	if err := checkCompletion(content.String(), finishReason); err != nil {
+		return nil, fmt.Errorf("openai.CreateChatCompletionStream(): %w", err)
+	}
+
+	return &llm.ChatCompletionResponse{
+		Content: content.String(),
+	}, nil
+}
+
+func (c *Client) chatCompletionRequest(request *llm.CreateChatCompletionRequest) openai.ChatCompletionRequest {
 	messages := make([]openai.ChatCompletionMessage, len(request.Messages))
 	for i, message := range request.Messages {
 		messages[i] = openai.ChatCompletionMessage{
@@ -34,15 +121,83 @@ func (c *Client) CreateChatCompletion(ctx context.Context, request *llm.CreateCh
 		}
 	}
 
-	resp, err := c.openai.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model:    "gpt-4o-mini",
+	model := request.Model
+	if model == "" {
+		model = c.model
+	}
+
+	return openai.ChatCompletionRequest{
+		Model:    model,
 		Messages: messages,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("openai.CreateChatCompletion(): %w", err)
+	}
+}
+
+func checkCompletion(content string, finishReason openai.FinishReason) error {
+	if finishReason == openai.FinishReasonContentFilter {
+		return llm.ErrContentFiltered
+	}
+	if content == "" {
+		return fmt.Errorf("no content: %w", llm.ErrEmptyResponse)
+	}
+	return nil
+}
+
+// apiError converts errors of the go-openai client into llm.APIError.
+// Errors that didn't come from the API, i.e. a cancelled context, are returned unchanged.
+func apiError(err error, retryAfter time.Duration) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
 	}
 
-	return &llm.ChatCompletionResponse{
-		Content: resp.Choices[0].Message.Content,
-	}, nil
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return &llm.APIError{
+			Kind:       errorKind(apiErr.HTTPStatusCode, apiErr.Code),
+			StatusCode: apiErr.HTTPStatusCode,
+			RetryAfter: retryAfter,
+			Err:        err,
+		}
+	}
+
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) {
+		return &llm.APIError{
+			Kind:       errorKind(requestErr.HTTPStatusCode, nil),
+			StatusCode: requestErr.HTTPStatusCode,
+			RetryAfter: retryAfter,
+			Err:        err,
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return &llm.APIError{
+			Err: err,
+		}
+	}
+
+	return err
+}
+
+// errorKind classifies a failure by its error code, see https://platform.openai.com/docs/guides/error-codes,
+// falling back to the HTTP status code.
+func errorKind(statusCode int, code any) error {
+	switch code {
+	case "context_length_exceeded":
+		return llm.ErrContextLengthExceeded
+	case "content_filter", "content_policy_violation":
+		return llm.ErrContentFiltered
+	case "invalid_api_key", "insufficient_quota":
+		// a 429 without quota is an account problem, retrying doesn't help until it's topped up
+		return llm.ErrAuthFailed
+	}
+
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return llm.ErrAuthFailed
+	case http.StatusTooManyRequests:
+		return llm.ErrRateLimited
+	}
+
+	return nil
 }
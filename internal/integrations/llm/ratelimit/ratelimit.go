@@ -0,0 +1,145 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"pleto.dev/chattest/internal/integrations/llm"
+)
+
+const window = time.Minute
+
+type Config struct {
+	// RequestsPerMinute caps the number of requests sent in any minute. Zero means no limit.
+	RequestsPerMinute int
+	// TokensPerMinute caps the estimated prompt and completion tokens in any minute. Zero means no limit.
+	TokensPerMinute int
+}
+
+// Client is an llm.LLM decorator that enforces client-side request and token rate limits
+// over a sliding window of one minute, blocking until a request fits.
+type Client struct {
+	llm llm.LLM
+	cfg Config
+
+	mu   sync.Mutex
+	sent []*sentRequest
+}
+
+type sentRequest struct {
+	at     time.Time
+	tokens int
+}
+
+var _ llm.StreamingLLM = &Client{}
+
+func NewClient(llm llm.LLM, cfg Config) *Client {
+	return &Client{
+		llm: llm,
+		cfg: cfg,
+	}
+}
+
+func Middleware(cfg Config) llm.Middleware {
+	return func(next llm.LLM) llm.LLM {
+		return NewClient(next, cfg)
+	}
+}
+
+func (c *Client) CreateChatCompletion(ctx context.Context, request *llm.CreateChatCompletionRequest) (*llm.ChatCompletionResponse, error) {
+	return c.CreateChatCompletionStream(ctx, request, nil)
+}
+
+func (c *Client) CreateChatCompletionStream(ctx context.Context, request *llm.CreateChatCompletionRequest, onDelta func(delta string)) (*llm.ChatCompletionResponse, error) {
+	sent, err := c.wait(ctx, llm.EstimateRequestTokens(request))
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := llm.Stream(ctx, c.llm, request, onDelta)
+	if err != nil {
+		return nil, err
+	}
+
+	// the completion counts against the token limit too, but its size is only known now
+	c.mu.Lock()
+	sent.tokens += llm.EstimateTokens(response.Content)
+	c.mu.Unlock()
+
+	return response, nil
+}
+
+// wait blocks until a request of the given size fits in the limits, and reserves it.
+func (c *Client) wait(ctx context.Context, tokens int) (*sentRequest, error) {
+	for {
+		c.mu.Lock()
+		delay := c.reserveDelay(tokens)
+		if delay == 0 {
+			sent := &sentRequest{at: time.Now(), tokens: tokens}
+			c.sent = append(c.sent, sent)
+			c.mu.Unlock()
+			return sent, nil
+		}
+		c.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserveDelay returns how long to wait until a request of the given size fits in the limits,
+// or 0 if it fits now. The caller must hold c.mu.
+func (c *Client) reserveDelay(tokens int) time.Duration {
+	now := time.Now()
+
+	// forget the requests that left the window
+	i := 0
+	for i < len(c.sent) && now.Sub(c.sent[i].at) >= window {
+		i++
+	}
+	c.sent = c.sent[i:]
+
+	if len(c.sent) == 0 {
+		// a single request bigger than the token limit would never fit otherwise
+		return 0
+	}
+
+	return max(c.requestsDelay(now), c.tokensDelay(now, tokens))
+}
+
+func (c *Client) requestsDelay(now time.Time) time.Duration {
+	if c.cfg.RequestsPerMinute <= 0 || len(c.sent) < c.cfg.RequestsPerMinute {
+		return 0
+	}
+	// wait for enough of the oldest requests to leave the window
+	return c.sent[len(c.sent)-c.cfg.RequestsPerMinute].at.Add(window).Sub(now)
+}
+
+func (c *Client) tokensDelay(now time.Time, tokens int) time.Duration {
+	if c.cfg.TokensPerMinute <= 0 {
+		return 0
+	}
+
+	used := 0
+	for _, sent := range c.sent {
+		used += sent.tokens
+	}
+
+	// wait for the oldest requests to leave the window until the new one fits,
+	// at worst until the window is empty
+	var delay time.Duration
+	for _, sent := range c.sent {
+		if used+tokens <= c.cfg.TokensPerMinute {
+			break
+		}
+		used -= sent.tokens
+		delay = sent.at.Add(window).Sub(now)
+	}
+	return delay
+}
@@ -0,0 +1,97 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"pleto.dev/chattest/internal/integrations/llm"
+)
+
+type Config struct {
+	// MaxRetries is how many times a failed request is retried. Zero disables retries.
+	MaxRetries int
+	// BaseDelay is the backoff before the first retry; it doubles with every attempt.
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff, but not a longer delay asked for by the provider.
+	MaxDelay time.Duration
+}
+
+// Client is an llm.LLM decorator that retries retryable llm.APIError failures
+// with jittered exponential backoff, honoring the provider's Retry-After.
+type Client struct {
+	llm llm.LLM
+	cfg Config
+}
+
+var _ llm.StreamingLLM = &Client{}
+
+func NewClient(llm llm.LLM, cfg Config) *Client {
+	return &Client{
+		llm: llm,
+		cfg: cfg,
+	}
+}
+
+func Middleware(cfg Config) llm.Middleware {
+	return func(next llm.LLM) llm.LLM {
+		return NewClient(next, cfg)
+	}
+}
+
+func (c *Client) CreateChatCompletion(ctx context.Context, request *llm.CreateChatCompletionRequest) (*llm.ChatCompletionResponse, error) {
+	return c.CreateChatCompletionStream(ctx, request, nil)
+}
+
+// CreateChatCompletionStream streams every attempt from the wrapped LLM.
+// The deltas of a failed attempt were already handed out, so onDelta may see a partial completion before a retry.
+func (c *Client) CreateChatCompletionStream(ctx context.Context, request *llm.CreateChatCompletionRequest, onDelta func(delta string)) (*llm.ChatCompletionResponse, error) {
+	for attempt := 0; ; attempt++ {
+		response, err := llm.Stream(ctx, c.llm, request, onDelta)
+		if err == nil {
+			return response, nil
+		}
+
+		var apiErr *llm.APIError
+		if !errors.As(err, &apiErr) || !apiErr.Retryable() || attempt >= c.cfg.MaxRetries {
+			return nil, err
+		}
+
+		if err := sleep(ctx, c.delay(attempt, apiErr.RetryAfter)); err != nil {
+			return nil, fmt.Errorf("giving up after %d attempts: %w", attempt+1, errors.Join(err, apiErr))
+		}
+	}
+}
+
+// delay uses the "full jitter" strategy: a random delay between zero and the exponential backoff,
+// so that clients hitting the same limit don't retry in lockstep.
+func (c *Client) delay(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+
+	backoff := c.cfg.BaseDelay << attempt
+	if backoff <= 0 || (c.cfg.MaxDelay > 0 && backoff > c.cfg.MaxDelay) {
+		// the shift overflowed, or the backoff grew past the cap
+		backoff = c.cfg.MaxDelay
+	}
+	if backoff <= 0 {
+		return 0
+	}
+
+	return rand.N(backoff)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -6,36 +6,98 @@ import (
 	"io"
 	"os"
 	"os/signal"
+	"time"
 
 	"pleto.dev/chattest/internal/chattest"
+	"pleto.dev/chattest/internal/integrations/llm"
+	"pleto.dev/chattest/internal/integrations/llm/cache"
+	"pleto.dev/chattest/internal/integrations/llm/cassette"
+	"pleto.dev/chattest/internal/integrations/llm/mockai"
 	"pleto.dev/chattest/internal/integrations/llm/openai"
+	"pleto.dev/chattest/internal/integrations/llm/ratelimit"
+	"pleto.dev/chattest/internal/integrations/llm/retry"
 )
 
 func run(ctx context.Context, w io.Writer) error {
 	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
 	defer cancel()
 
-	openApiKey, found := os.LookupEnv("OPENAI_API_KEY")
-	if !found {
-		return fmt.Errorf("OPENAI_API_KEY environment variable not set")
+	cfg, err := chattest.NewConfig()
+	if err != nil {
+		return err
 	}
 
-	openAIClient := openai.NewClient(openai.Config{
-		APIKey: openApiKey,
-	})
-
-	cfg, err := chattest.NewConfig()
+	client, err := newLLM(cfg)
 	if err != nil {
 		return err
 	}
 
-	if err := chattest.Run(ctx, cfg, openAIClient, w); err != nil {
+	if err := chattest.Run(ctx, cfg, client, w); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+func newLLM(cfg *chattest.Config) (llm.LLM, error) {
+	// a dry run never calls the LLM
+	if cfg.DryRun || cfg.DryRunJSON {
+		return mockai.NewClient(), nil
+	}
+
+	// replaying a cassette works offline, so it doesn't need an API key
+	if cfg.CassettePath != "" && cassette.Mode(cfg.CassetteMode) == cassette.ModeReplay {
+		return cassette.NewClient(nil, cassette.Config{
+			Path: cfg.CassettePath,
+			Mode: cassette.ModeReplay,
+		})
+	}
+
+	openApiKey, found := os.LookupEnv("OPENAI_API_KEY")
+	if !found {
+		return nil, fmt.Errorf("OPENAI_API_KEY environment variable not set")
+	}
+
+	// every retry attempt goes through the rate limiter
+	client := llm.Chain(
+		openai.NewClient(openai.Config{
+			APIKey: openApiKey,
+			Model:  cfg.Model,
+		}),
+		retry.Middleware(retry.Config{
+			MaxRetries: cfg.MaxRetries,
+			BaseDelay:  time.Second,
+			MaxDelay:   time.Minute,
+		}),
+		ratelimit.Middleware(ratelimit.Config{
+			RequestsPerMinute: cfg.RequestsPerMin,
+			TokensPerMinute:   cfg.TokensPerMin,
+		}),
+	)
+
+	if !cfg.NoCache {
+		cacheClient, err := cache.NewClient(client, cache.Config{
+			Dir:      cfg.CacheDir,
+			TTL:      cfg.CacheTTL,
+			MaxBytes: cfg.CacheMaxBytes,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cache.NewClient(): %w", err)
+		}
+		client = cacheClient
+	}
+
+	// the cassette wraps the cache, so cache hits are recorded too and the cassette replays without it
+	if cfg.CassettePath != "" {
+		return cassette.NewClient(client, cassette.Config{
+			Path: cfg.CassettePath,
+			Mode: cassette.Mode(cfg.CassetteMode),
+		})
+	}
+
+	return client, nil
+}
+
 func main() {
 	ctx := context.Background()
 	if err := run(ctx, os.Stdout); err != nil {